@@ -0,0 +1,268 @@
+// Command diggle is a DNS lookup tool in the style of dig, built on the same
+// packet codec and transport as the resolver.
+//
+// Usage:
+//
+//	diggle [@server] [-p port] [-x addr] [name] [type] [class] [+[no]option...]
+//
+// Options are +trace, +rec (on by default), +tcp and +short.
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/davidseybold/dns-resolver/dns"
+	"github.com/davidseybold/dns-resolver/resolver/transport"
+)
+
+const resolvConf = "/etc/resolv.conf"
+
+type options struct {
+	server string
+	port   string
+
+	name   dns.Name
+	qType  dns.Type
+	qClass dns.Class
+
+	trace   bool
+	recurse bool
+	tcp     bool
+	short   bool
+}
+
+func main() {
+	opts, err := parseArgs(os.Args[1:])
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "diggle: %v\n", err)
+		fmt.Fprintln(os.Stderr, "usage: diggle [@server] [-p port] [-x addr] [name] [type] [class] [+[no]trace|rec|tcp|short]")
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+	t := transport.New()
+
+	if opts.trace {
+		err = trace(ctx, t, opts)
+	} else {
+		err = query(ctx, t, opts)
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "diggle: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func parseArgs(args []string) (options, error) {
+	opts := options{
+		port:    "53",
+		qClass:  dns.ClassIN,
+		recurse: true,
+	}
+	var hasType bool
+
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case strings.HasPrefix(arg, "@"):
+			opts.server = arg[1:]
+		case strings.HasPrefix(arg, "+"):
+			if err := opts.setFlag(arg[1:]); err != nil {
+				return opts, err
+			}
+		case arg == "-x" || arg == "-p" || arg == "-t" || arg == "-c":
+			if i+1 == len(args) {
+				return opts, fmt.Errorf("%s needs an argument", arg)
+			}
+			i++
+			if err := opts.setOption(arg, args[i]); err != nil {
+				return opts, err
+			}
+			if arg == "-x" || arg == "-t" {
+				hasType = true
+			}
+		case strings.HasPrefix(arg, "-"):
+			return opts, fmt.Errorf("unknown option %s", arg)
+		default:
+			if t, err := dns.ParseType(arg); err == nil && !hasType {
+				opts.qType, hasType = t, true
+				continue
+			}
+			if c, err := dns.ParseClass(arg); err == nil {
+				opts.qClass = c
+				continue
+			}
+			name, err := dns.ParseName(arg, dns.NewName("."))
+			if err != nil {
+				return opts, err
+			}
+			opts.name = name
+		}
+	}
+
+	// As with dig, no name means a query for the root name servers.
+	if opts.name == nil {
+		opts.name = dns.NewName(".")
+		if !hasType {
+			opts.qType = dns.TypeNS
+		}
+	} else if !hasType {
+		opts.qType = dns.TypeA
+	}
+	return opts, nil
+}
+
+func (o *options) setFlag(flag string) error {
+	value := !strings.HasPrefix(flag, "no")
+	switch strings.TrimPrefix(flag, "no") {
+	case "trace":
+		o.trace = value
+	case "rec", "recurse":
+		o.recurse = value
+	case "tcp", "vc":
+		o.tcp = value
+	case "short":
+		o.short = value
+	default:
+		return fmt.Errorf("unknown option +%s", flag)
+	}
+	return nil
+}
+
+func (o *options) setOption(opt, value string) error {
+	switch opt {
+	case "-x":
+		ip := net.ParseIP(value)
+		if ip == nil {
+			return fmt.Errorf("invalid address %q", value)
+		}
+		name, err := dns.ReverseName(ip)
+		if err != nil {
+			return err
+		}
+		o.name, o.qType = name, dns.TypePTR
+	case "-p":
+		o.port = value
+	case "-t":
+		t, err := dns.ParseType(value)
+		if err != nil {
+			return err
+		}
+		o.qType = t
+	case "-c":
+		c, err := dns.ParseClass(value)
+		if err != nil {
+			return err
+		}
+		o.qClass = c
+	}
+	return nil
+}
+
+// query sends a single query to the server and prints the response.
+func query(ctx context.Context, t *transport.Transport, opts options) error {
+	server, err := serverAddress(opts.server)
+	if err != nil {
+		return err
+	}
+	addr := net.JoinHostPort(server.String(), opts.port)
+
+	q := newQuery(opts.name, opts.qType, opts.qClass, opts.recurse)
+	start := time.Now()
+	resp, err := exchange(ctx, t, addr, q, opts.tcp)
+	rtt := time.Since(start)
+	if err != nil {
+		return err
+	}
+
+	if opts.short {
+		printShort(resp)
+		return nil
+	}
+
+	fmt.Printf("\n; <<>> diggle <<>> %s\n", joinArgs())
+	fmt.Println(";; Got answer:")
+	fmt.Print(resp)
+	fmt.Println()
+	fmt.Printf(";; Query time: %d msec\n", rtt.Milliseconds())
+	fmt.Printf(";; SERVER: %s#%s(%s)\n", server, opts.port, server)
+	fmt.Printf(";; WHEN: %s\n", start.Format(time.RFC1123))
+	fmt.Println()
+	return nil
+}
+
+func joinArgs() string {
+	return strings.Join(os.Args[1:], " ")
+}
+
+func printShort(resp dns.Packet) {
+	for _, rr := range resp.Answers {
+		fmt.Println(dns.FormatRecordData(rr.Data))
+	}
+}
+
+func newQuery(name dns.Name, t dns.Type, c dns.Class, recurse bool) dns.Packet {
+	p := dns.Packet{
+		Questions: []dns.Question{{Name: name, Type: t, Class: c}},
+		OPT: &dns.OPT{
+			UDPPayloadSize: dns.DefaultUDPPayloadSize,
+		},
+	}
+	p.ID = transport.NewID()
+	p.Flags.RecursionDesired = recurse
+	return p
+}
+
+func exchange(ctx context.Context, t *transport.Transport, addr string, q dns.Packet, tcp bool) (dns.Packet, error) {
+	if tcp {
+		return t.ExchangeTCP(ctx, addr, q)
+	}
+	return t.Exchange(ctx, addr, q)
+}
+
+// serverAddress resolves the server given on the command line, or finds the
+// first name server in resolv.conf if none was given.
+func serverAddress(server string) (net.IP, error) {
+	if server == "" {
+		return systemServer()
+	}
+	if ip := net.ParseIP(server); ip != nil {
+		return ip, nil
+	}
+	ips, err := net.LookupIP(server)
+	if err != nil {
+		return nil, err
+	}
+	return ips[0], nil
+}
+
+func systemServer() (net.IP, error) {
+	f, err := os.Open(resolvConf)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 2 || fields[0] != "nameserver" {
+			continue
+		}
+		// Scoped IPv6 addresses are not supported.
+		if ip := net.ParseIP(fields[1]); ip != nil {
+			return ip, nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return nil, errors.New("no name server found in " + resolvConf)
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"time"
+
+	"github.com/davidseybold/dns-resolver/dns"
+	"github.com/davidseybold/dns-resolver/resolver"
+	"github.com/davidseybold/dns-resolver/resolver/transport"
+)
+
+// maxTraceSteps bounds the number of referrals followed by +trace.
+const maxTraceSteps = 32
+
+type nameServer struct {
+	name dns.Name
+	addr net.IP
+}
+
+// trace follows referrals from the root down to the servers for the name, as
+// dig +trace does. The root name servers are found by asking the server for
+// them, falling back to the built in root hints, and the addresses of servers
+// given without glue are looked up through the same server.
+func trace(ctx context.Context, t *transport.Transport, opts options) error {
+	server, err := serverAddress(opts.server)
+	if err != nil {
+		return err
+	}
+	recursive := net.JoinHostPort(server.String(), opts.port)
+
+	fmt.Printf("\n; <<>> diggle <<>> %s\n", joinArgs())
+
+	root := dns.NewName(".")
+	servers := []nameServer{}
+	resp, err := exchange(ctx, t, recursive, newQuery(root, dns.TypeNS, dns.ClassIN, true), opts.tcp)
+	if err == nil && len(resp.Answers) > 0 {
+		printRecords(resp.Answers, opts.short)
+		fmt.Printf(";; Received from %s#%s(%s)\n\n", server, opts.port, server)
+		servers = delegation(ctx, t, recursive, opts, root, resp.Answers, resp.Additional)
+	}
+	if len(servers) == 0 {
+		servers = delegation(ctx, t, recursive, opts, root, resolver.RootHints(), resolver.RootHints())
+	}
+
+	zone := root
+	for step := 0; step < maxTraceSteps; step++ {
+		resp, from, rtt, err := queryServers(ctx, t, servers, opts)
+		if err != nil {
+			return err
+		}
+		printRecords(resp.Answers, opts.short)
+		printRecords(resp.Authorities, opts.short)
+		fmt.Printf(";; Received from %s#53(%s) in %d ms\n\n", from.addr, from.name, rtt.Milliseconds())
+
+		if resp.ResponseCode != dns.ResponseCodeNoError || len(resp.Answers) > 0 {
+			return nil
+		}
+
+		cut, nsRecords := referral(resp, opts.name, zone)
+		if cut == nil {
+			return nil
+		}
+		servers = delegation(ctx, t, recursive, opts, cut, nsRecords, resp.Additional)
+		if len(servers) == 0 {
+			return fmt.Errorf("no addresses found for the servers of %s", cut)
+		}
+		zone = cut
+	}
+	return errors.New("too many referrals")
+}
+
+// queryServers sends the query to each of the servers in turn until one of
+// them responds.
+func queryServers(ctx context.Context, t *transport.Transport, servers []nameServer, opts options) (dns.Packet, nameServer, time.Duration, error) {
+	var lastErr error
+	for _, s := range servers {
+		q := newQuery(opts.name, opts.qType, opts.qClass, false)
+		start := time.Now()
+		resp, err := exchange(ctx, t, transport.Address(s.addr), q, opts.tcp)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		return resp, s, time.Since(start), nil
+	}
+	if lastErr == nil {
+		lastErr = errors.New("no servers to query")
+	}
+	return dns.Packet{}, nameServer{}, 0, lastErr
+}
+
+// referral returns the zone a response delegates to, if it is closer to the
+// name than the current zone.
+func referral(resp dns.Packet, name, zone dns.Name) (dns.Name, []dns.ResourceRecord) {
+	for _, rr := range resp.Authorities {
+		if rr.Type != dns.TypeNS || !name.IsSubdomainOf(rr.Name) {
+			continue
+		}
+		if rr.Name.Equals(zone) || !rr.Name.IsSubdomainOf(zone) {
+			continue
+		}
+		nsRecords := []dns.ResourceRecord{}
+		for _, ns := range resp.Authorities {
+			if ns.Type == dns.TypeNS && ns.Name.Equals(rr.Name) {
+				nsRecords = append(nsRecords, ns)
+			}
+		}
+		return rr.Name, nsRecords
+	}
+	return nil, nil
+}
+
+// delegation finds the addresses of the name servers of zone, from the glue
+// if there is any and by asking the recursive server otherwise.
+func delegation(ctx context.Context, t *transport.Transport, recursive string, opts options, zone dns.Name, nsRecords, glue []dns.ResourceRecord) []nameServer {
+	servers := []nameServer{}
+	for _, rr := range nsRecords {
+		ns, ok := rr.Data.(*dns.NSRecordData)
+		if rr.Type != dns.TypeNS || !ok || !rr.Name.Equals(zone) {
+			continue
+		}
+
+		var addr net.IP
+		for _, g := range glue {
+			if a, ok := g.Data.(*dns.ARecordData); ok && g.Name.Equals(ns.Name) {
+				addr = a.Address
+				break
+			}
+		}
+		if addr == nil {
+			addr = lookupAddress(ctx, t, recursive, opts, ns.Name)
+		}
+		if addr != nil {
+			servers = append(servers, nameServer{name: ns.Name, addr: addr})
+		}
+	}
+	return servers
+}
+
+func lookupAddress(ctx context.Context, t *transport.Transport, recursive string, opts options, name dns.Name) net.IP {
+	resp, err := exchange(ctx, t, recursive, newQuery(name, dns.TypeA, dns.ClassIN, true), opts.tcp)
+	if err != nil {
+		return nil
+	}
+	for _, rr := range resp.Answers {
+		if a, ok := rr.Data.(*dns.ARecordData); ok {
+			return a.Address
+		}
+	}
+	return nil
+}
+
+func printRecords(records []dns.ResourceRecord, short bool) {
+	for _, rr := range records {
+		if short {
+			fmt.Printf("%s %s\n", rr.Type, dns.FormatRecordData(rr.Data))
+			continue
+		}
+		fmt.Println(rr)
+	}
+}
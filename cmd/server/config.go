@@ -0,0 +1,191 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/BurntSushi/toml"
+
+	"github.com/davidseybold/dns-resolver/resolver/cache"
+)
+
+const (
+	modeRecursive = "recursive"
+	modeForward   = "forward"
+
+	levelInfo  = "info"
+	levelError = "error"
+)
+
+// config is the configuration of the server, read from a TOML file.
+type config struct {
+	// ShutdownTimeout is how long queries already received are given to be
+	// answered when the server shuts down or reloads.
+	ShutdownTimeout duration `toml:"shutdown_timeout"`
+
+	Listen   listenConfig   `toml:"listen"`
+	TCP      tcpConfig      `toml:"tcp"`
+	Cache    cacheConfig    `toml:"cache"`
+	Upstream upstreamConfig `toml:"upstream"`
+	Log      logConfig      `toml:"log"`
+}
+
+type listenConfig struct {
+	UDP []string `toml:"udp"`
+	TCP []string `toml:"tcp"`
+}
+
+type tcpConfig struct {
+	IdleTimeout    duration `toml:"idle_timeout"`
+	WriteTimeout   duration `toml:"write_timeout"`
+	MaxConnections int      `toml:"max_connections"`
+	// MaxPipelined is the number of queries on a connection resolved at
+	// once.
+	MaxPipelined int `toml:"max_pipelined"`
+}
+
+type cacheConfig struct {
+	// MaxTTL caps how long records are cached. Zero means no limit.
+	MaxTTL duration `toml:"max_ttl"`
+	// MaxEntries and MaxSize limit the number of RRsets and negative
+	// responses cached and the approximate bytes they take up. Zero means
+	// no limit.
+	MaxEntries int `toml:"max_entries"`
+	MaxSize    int `toml:"max_size"`
+	// SweepInterval is how often expired entries are removed. Zero means
+	// only when they are looked up.
+	SweepInterval duration `toml:"sweep_interval"`
+}
+
+type upstreamConfig struct {
+	// Mode is either recursive, to resolve names iteratively from the root,
+	// or forward, to send queries to the forwarders.
+	Mode       string   `toml:"mode"`
+	Forwarders []string `toml:"forwarders"`
+	// RootHints is a named.root file replacing the built in root hints.
+	RootHints string `toml:"root_hints"`
+	// RandomizeCase sends query names in random case and rejects responses
+	// that do not echo it (DNS 0x20).
+	RandomizeCase bool `toml:"randomize_case"`
+}
+
+type logConfig struct {
+	// Level is info or error.
+	Level string `toml:"level"`
+	// File is appended to, or standard error is used if it is empty.
+	File string `toml:"file"`
+}
+
+// duration is a time.Duration read from a string such as "10s".
+type duration struct {
+	time.Duration
+}
+
+func (d *duration) UnmarshalText(text []byte) error {
+	var err error
+	d.Duration, err = time.ParseDuration(string(text))
+	return err
+}
+
+func defaultConfig() config {
+	return config{
+		ShutdownTimeout: duration{5 * time.Second},
+		Listen: listenConfig{
+			UDP: []string{":53"},
+			TCP: []string{":53"},
+		},
+		TCP: tcpConfig{
+			IdleTimeout:    duration{10 * time.Second},
+			WriteTimeout:   duration{10 * time.Second},
+			MaxConnections: 128,
+			MaxPipelined:   32,
+		},
+		Cache: cacheConfig{
+			MaxEntries:    cache.DefaultMaxEntries,
+			MaxSize:       cache.DefaultMaxSize,
+			SweepInterval: duration{cache.DefaultSweepInterval},
+		},
+		Upstream: upstreamConfig{
+			Mode: modeRecursive,
+		},
+		Log: logConfig{
+			Level: levelInfo,
+		},
+	}
+}
+
+// loadConfig reads the config file at path. Settings missing from the file
+// keep their default values.
+func loadConfig(path string) (config, error) {
+	cfg := defaultConfig()
+	md, err := toml.DecodeFile(path, &cfg)
+	if err != nil {
+		return config{}, err
+	}
+	if undecoded := md.Undecoded(); len(undecoded) > 0 {
+		keys := make([]string, len(undecoded))
+		for i, k := range undecoded {
+			keys[i] = k.String()
+		}
+		return config{}, fmt.Errorf("%s: unknown settings %s", path, strings.Join(keys, ", "))
+	}
+	if err := cfg.validate(); err != nil {
+		return config{}, fmt.Errorf("%s: %w", path, err)
+	}
+	return cfg, nil
+}
+
+func (c config) validate() error {
+	if len(c.Listen.UDP) == 0 && len(c.Listen.TCP) == 0 {
+		return errors.New("no listen addresses")
+	}
+	if c.TCP.MaxConnections <= 0 {
+		return errors.New("tcp.max_connections must be positive")
+	}
+	if c.TCP.MaxPipelined <= 0 {
+		return errors.New("tcp.max_pipelined must be positive")
+	}
+	if c.TCP.IdleTimeout.Duration <= 0 || c.TCP.WriteTimeout.Duration <= 0 {
+		return errors.New("tcp.idle_timeout and tcp.write_timeout must be positive")
+	}
+	if c.Cache.MaxEntries < 0 || c.Cache.MaxSize < 0 {
+		return errors.New("cache.max_entries and cache.max_size must not be negative")
+	}
+	if c.Cache.SweepInterval.Duration < 0 {
+		return errors.New("cache.sweep_interval must not be negative")
+	}
+
+	switch c.Upstream.Mode {
+	case modeRecursive:
+	case modeForward:
+		if len(c.Upstream.Forwarders) == 0 {
+			return errors.New("upstream.forwarders is required in forward mode")
+		}
+	default:
+		return fmt.Errorf("unknown upstream.mode %q", c.Upstream.Mode)
+	}
+	if _, err := c.forwarders(); err != nil {
+		return err
+	}
+
+	switch c.Log.Level {
+	case levelInfo, levelError:
+	default:
+		return fmt.Errorf("unknown log.level %q", c.Log.Level)
+	}
+	return nil
+}
+
+func (c config) forwarders() ([]net.IP, error) {
+	addrs := make([]net.IP, len(c.Upstream.Forwarders))
+	for i, f := range c.Upstream.Forwarders {
+		addrs[i] = net.ParseIP(f)
+		if addrs[i] == nil {
+			return nil, fmt.Errorf("invalid forwarder address %q", f)
+		}
+	}
+	return addrs, nil
+}
@@ -1,5 +1,338 @@
+// Command server runs the resolver as a DNS server over UDP and TCP.
+//
+// It reads its settings from a TOML config file (see server.example.toml).
+// SIGHUP reloads the config and reopens the log file, and SIGTERM or SIGINT
+// stop the server once the queries it has received are answered.
 package main
 
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"os/signal"
+	"reflect"
+	"syscall"
+
+	"github.com/davidseybold/dns-resolver/network/tcp"
+	"github.com/davidseybold/dns-resolver/network/udp"
+	"github.com/davidseybold/dns-resolver/resolver"
+	"github.com/davidseybold/dns-resolver/resolver/cache"
+)
+
+// listener is a UDP or TCP server.
+type listener interface {
+	SetResolver(r *resolver.Resolver)
+	Shutdown(ctx context.Context) error
+}
+
+type daemon struct {
+	cfg config
+	// log stays the same across reloads, which only change where it writes
+	// to, so that the servers always log to the current file.
+	log      *logger
+	resolver *resolver.Resolver
+	cache    *cache.Cache
+	servers  []listener
+	// errs receives the errors of servers that stopped listening.
+	errs chan error
+}
+
 func main() {
+	path := flag.String("config", "/etc/diggle/server.toml", "path of the config file")
+	flag.Parse()
+
+	cfg, err := loadConfig(*path)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "server:", err)
+		os.Exit(1)
+	}
+
+	d := &daemon{errs: make(chan error, 1)}
+	r, c, l, err := d.prepare(cfg)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "server:", err)
+		os.Exit(1)
+	}
+	d.use(cfg, r, c, l)
+	if err := d.listen(cfg, r); err != nil {
+		d.log.Errorf("%v", err)
+		os.Exit(1)
+	}
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP, syscall.SIGTERM, syscall.SIGINT)
+	for {
+		select {
+		case sig := <-signals:
+			if sig == syscall.SIGHUP {
+				if err := d.reload(*path); err != nil {
+					d.log.Errorf("reload: %v", err)
+					d.stop()
+					os.Exit(1)
+				}
+				continue
+			}
+			d.log.Infof("received %s, shutting down", sig)
+			d.stop()
+			return
+		case err := <-d.errs:
+			d.log.Errorf("server stopped: %v", err)
+			d.stop()
+			os.Exit(1)
+		}
+	}
+}
+
+// prepare opens the log and creates the resolver and cache for cfg, priming a
+// new recursive resolver. The current resolver and cache are reused unless
+// their settings changed.
+func (d *daemon) prepare(cfg config) (*resolver.Resolver, *cache.Cache, *logger, error) {
+	r, c := d.resolver, d.cache
+	if r == nil || !reflect.DeepEqual(cfg.Upstream, d.cfg.Upstream) || !reflect.DeepEqual(cfg.Cache, d.cfg.Cache) {
+		var err error
+		if r, c, err = newResolver(cfg); err != nil {
+			return nil, nil, nil, err
+		}
+	}
+
+	l, err := newLogger(cfg.Log)
+	if err != nil {
+		if c != d.cache {
+			c.Close()
+		}
+		return nil, nil, nil, err
+	}
+
+	// A new resolver learns the root name servers now rather than while
+	// answering its first query.
+	if r != d.resolver && cfg.Upstream.Mode == modeRecursive {
+		if err := r.Prime(); err != nil {
+			l.Errorf("priming root name servers: %v", err)
+		}
+	}
+	return r, c, l, nil
+}
+
+// use makes cfg, and the resolver, cache and log prepared for it, current.
+// The servers answer with the resolver from now on.
+func (d *daemon) use(cfg config, r *resolver.Resolver, c *cache.Cache, l *logger) {
+	if d.log == nil {
+		d.log = l
+	} else {
+		d.log.replace(l)
+	}
+	if d.cache != nil && d.cache != c {
+		d.cache.Close()
+	}
+	if r != d.resolver {
+		for _, s := range d.servers {
+			s.SetResolver(r)
+		}
+	}
+	d.cfg, d.resolver, d.cache = cfg, r, c
+}
+
+// discard releases a resolver, cache and log prepared for a config that is
+// not going to be used.
+func (d *daemon) discard(c *cache.Cache, l *logger) {
+	if c != d.cache {
+		c.Close()
+	}
+	l.Close()
+}
+
+// listen opens all the listen addresses of cfg and starts a server on each
+// of them. If any of them cannot be opened none are served.
+func (d *daemon) listen(cfg config, r *resolver.Resolver) error {
+	servers := []listener{}
+	serves := []func() error{}
+	opened := []io.Closer{}
+	fail := func(err error) error {
+		for _, c := range opened {
+			c.Close()
+		}
+		return err
+	}
+
+	for _, addr := range cfg.Listen.UDP {
+		udpAddr, err := net.ResolveUDPAddr("udp", addr)
+		if err != nil {
+			return fail(err)
+		}
+		conn, err := net.ListenUDP("udp", udpAddr)
+		if err != nil {
+			return fail(err)
+		}
+		opened = append(opened, conn)
+
+		s := udp.NewUDPServer(addr, r, udp.WithErrorLog(d.log.Logger))
+		servers = append(servers, s)
+		serves = append(serves, func() error { return s.Serve(conn) })
+	}
+	for _, addr := range cfg.Listen.TCP {
+		l, err := net.Listen("tcp", addr)
+		if err != nil {
+			return fail(err)
+		}
+		opened = append(opened, l)
+
+		s := tcp.NewTCPServer(addr, r,
+			tcp.WithIdleTimeout(cfg.TCP.IdleTimeout.Duration),
+			tcp.WithWriteTimeout(cfg.TCP.WriteTimeout.Duration),
+			tcp.WithMaxConnections(cfg.TCP.MaxConnections),
+			tcp.WithMaxPipelined(cfg.TCP.MaxPipelined),
+			tcp.WithErrorLog(d.log.Logger),
+		)
+		servers = append(servers, s)
+		serves = append(serves, func() error { return s.Serve(l) })
+	}
+
+	d.servers = servers
+	for _, serve := range serves {
+		go func(serve func() error) {
+			if err := serve(); err != nil {
+				select {
+				case d.errs <- err:
+				default:
+				}
+			}
+		}(serve)
+	}
+	for _, addr := range cfg.Listen.UDP {
+		d.log.Infof("listening on %s/udp", addr)
+	}
+	for _, addr := range cfg.Listen.TCP {
+		d.log.Infof("listening on %s/tcp", addr)
+	}
+	return nil
+}
+
+// stop shuts down the servers, giving them the shutdown timeout to answer the
+// queries they have received.
+func (d *daemon) stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), d.cfg.ShutdownTimeout.Duration)
+	defer cancel()
+	for _, s := range d.servers {
+		if err := s.Shutdown(ctx); err != nil {
+			d.log.Errorf("shutdown: %v", err)
+		}
+	}
+	d.servers = nil
+}
+
+// reload reads the config again and applies it. The servers are only
+// restarted if their settings changed; otherwise they keep running and
+// answer with the new resolver. If the new config is invalid, or its listen
+// addresses cannot be opened, the server keeps running with the old one. An
+// error is only returned if the old listen addresses cannot be opened again
+// either.
+func (d *daemon) reload(path string) error {
+	cfg, err := loadConfig(path)
+	if err != nil {
+		d.log.Errorf("reload: %v", err)
+		return nil
+	}
+	r, c, l, err := d.prepare(cfg)
+	if err != nil {
+		d.log.Errorf("reload: %v", err)
+		return nil
+	}
+
+	d.log.Infof("reloading %s", path)
+	if !reflect.DeepEqual(cfg.Listen, d.cfg.Listen) || !reflect.DeepEqual(cfg.TCP, d.cfg.TCP) {
+		d.stop()
+		if err := d.listen(cfg, r); err != nil {
+			d.log.Errorf("reload: %v, keeping the previous config", err)
+			d.discard(c, l)
+			return d.listen(d.cfg, d.resolver)
+		}
+	}
+	d.use(cfg, r, c, l)
+	return nil
+}
+
+func newResolver(cfg config) (*resolver.Resolver, *cache.Cache, error) {
+	opts := []resolver.Option{}
+
+	if cfg.Upstream.RootHints != "" {
+		hints, err := resolver.LoadRootHints(cfg.Upstream.RootHints)
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, resolver.WithRootHints(hints))
+	}
+
+	if cfg.Upstream.Mode == modeForward {
+		forwarders, err := cfg.forwarders()
+		if err != nil {
+			return nil, nil, err
+		}
+		opts = append(opts, resolver.WithForwarders(forwarders))
+	}
+
+	if cfg.Upstream.RandomizeCase {
+		opts = append(opts, resolver.WithCaseRandomization())
+	}
+
+	c := cache.New(
+		cache.WithMaxTTL(cfg.Cache.MaxTTL.Duration),
+		cache.WithMaxEntries(cfg.Cache.MaxEntries),
+		cache.WithMaxSize(cfg.Cache.MaxSize),
+		cache.WithSweepInterval(cfg.Cache.SweepInterval.Duration),
+	)
+	opts = append(opts, resolver.WithCache(c))
+	return resolver.NewResolver(opts...), c, nil
+}
+
+// logger writes messages at or above its level.
+type logger struct {
+	*log.Logger
+	level string
+	file  io.Closer
+}
+
+func newLogger(cfg logConfig) (*logger, error) {
+	l := &logger{level: cfg.Level}
+	var out io.Writer = os.Stderr
+	if cfg.File != "" {
+		f, err := os.OpenFile(cfg.File, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+		if err != nil {
+			return nil, err
+		}
+		out, l.file = f, f
+	}
+	l.Logger = log.New(out, "", log.LstdFlags)
+	return l, nil
+}
+
+func (l *logger) Infof(format string, args ...interface{}) {
+	if l.level == levelInfo {
+		l.Printf(format, args...)
+	}
+}
+
+func (l *logger) Errorf(format string, args ...interface{}) {
+	l.Printf("error: "+format, args...)
+}
+
+// replace makes the logger write to the output of n, at its level, closing
+// its own file.
+func (l *logger) replace(n *logger) {
+	l.SetOutput(n.Writer())
+	l.level = n.level
+	if l.file != nil {
+		l.file.Close()
+	}
+	l.file = n.file
+}
 
+func (l *logger) Close() error {
+	if l.file == nil {
+		return nil
+	}
+	return l.file.Close()
 }
@@ -2,6 +2,7 @@ package dns
 
 import (
 	"errors"
+	"fmt"
 	"net"
 )
 
@@ -10,26 +11,21 @@ type ARecordData struct {
 	Address net.IP
 }
 
-func (a ARecordData) encode(w writeOffsetter, c *compressionCache) error {
-	err := writeByte(w, byte(4))
-	if err != nil {
-		return err
+func (a ARecordData) EncodeRecordData(w *RecordDataWriter) error {
+	addr := a.Address.To4()
+	if addr == nil {
+		return errors.New("invalid a record")
 	}
-	_, err = w.Write(a.Address.To4())
+	_, err := w.Write(addr)
 	return err
 }
 
-func (a *ARecordData) decode(r offsetReader) error {
-	dLen, err := readUint16(r)
-	if err != nil {
-		return err
-	}
-
-	if dLen != 4 {
+func (a *ARecordData) DecodeRecordData(r *RecordDataReader) error {
+	if r.Len() != net.IPv4len {
 		return errors.New("invalid a record")
 	}
 
-	d, err := readNBytes(r, int(dLen))
+	d, err := r.ReadBytes(net.IPv4len)
 	if err != nil {
 		return err
 	}
@@ -42,3 +38,15 @@ func (a *ARecordData) decode(r offsetReader) error {
 func (a ARecordData) String() string {
 	return a.Address.String()
 }
+
+func (a *ARecordData) ParseRecordData(fields []string, origin Name) error {
+	if err := checkFieldCount(fields, 1, TypeA); err != nil {
+		return err
+	}
+	addr := net.ParseIP(fields[0]).To4()
+	if addr == nil {
+		return fmt.Errorf("invalid ipv4 address %q", fields[0])
+	}
+	a.Address = addr
+	return nil
+}
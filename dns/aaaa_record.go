@@ -2,33 +2,31 @@ package dns
 
 import (
 	"errors"
+	"fmt"
 	"net"
+	"strings"
 )
 
+// An AAAA record
 type AAAARecordData struct {
 	Address net.IP
 }
 
-func (a AAAARecordData) encode(w writeOffsetter, c *compressionCache) error {
-	err := writeByte(w, byte(16))
-	if err != nil {
-		return err
+func (a AAAARecordData) EncodeRecordData(w *RecordDataWriter) error {
+	addr := a.Address.To16()
+	if addr == nil {
+		return errors.New("invalid aaaa record")
 	}
-	_, err = w.Write([]byte(a.Address))
+	_, err := w.Write(addr)
 	return err
 }
 
-func (a *AAAARecordData) decode(r offsetReader) error {
-	dLen, err := readUint16(r)
-	if err != nil {
-		return err
+func (a *AAAARecordData) DecodeRecordData(r *RecordDataReader) error {
+	if r.Len() != net.IPv6len {
+		return errors.New("invalid aaaa record")
 	}
 
-	if dLen != 4 {
-		return errors.New("invalid a record")
-	}
-
-	d, err := readNBytes(r, int(dLen))
+	d, err := r.ReadBytes(net.IPv6len)
 	if err != nil {
 		return err
 	}
@@ -38,6 +36,23 @@ func (a *AAAARecordData) decode(r offsetReader) error {
 	return nil
 }
 
+// String returns the address in IPv6 form, even if it is an IPv4-mapped
+// address, which net.IP would print as an IPv4 address.
 func (a AAAARecordData) String() string {
+	if ip4 := a.Address.To4(); ip4 != nil {
+		return "::ffff:" + ip4.String()
+	}
 	return a.Address.String()
 }
+
+func (a *AAAARecordData) ParseRecordData(fields []string, origin Name) error {
+	if err := checkFieldCount(fields, 1, TypeAAAA); err != nil {
+		return err
+	}
+	addr := net.ParseIP(fields[0])
+	if addr == nil || !strings.Contains(fields[0], ":") {
+		return fmt.Errorf("invalid ipv6 address %q", fields[0])
+	}
+	a.Address = addr
+	return nil
+}
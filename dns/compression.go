@@ -7,6 +7,9 @@ import (
 const (
 	pointerMask byte = 0xC0
 	labelMask   byte = 0x3F
+
+	// maxPointerOffset is the largest offset a compression pointer can hold.
+	maxPointerOffset = 0x3FFF
 )
 
 func createPointer(offset int) uint16 {
@@ -5,10 +5,6 @@ import (
 	"io"
 )
 
-type decoder interface {
-	decode(readSeekOffsetter) error
-}
-
 type readSeekOffsetter interface {
 	io.ReadSeeker
 	Offset() int
@@ -31,18 +27,18 @@ func (p *offsetReader) Offset() int {
 func DecodePacket(b []byte) (Packet, error) {
 	r := newOffsetReader(b)
 
-	var h *header
+	var h header
 	if err := h.decode(r); err != nil {
 		return Packet{}, err
 	}
 
 	questions := []Question{}
 	for i := 0; i < int(h.questionCount); i++ {
-		var q *Question
+		var q Question
 		if err := q.decode(r); err != nil {
 			return Packet{}, err
 		}
-		questions = append(questions, *q)
+		questions = append(questions, q)
 	}
 
 	answers := make([]ResourceRecord, h.answerCount)
@@ -53,22 +49,29 @@ func DecodePacket(b []byte) (Packet, error) {
 
 	recs := []ResourceRecord{}
 	for i := 0; i < int(tRecs); i++ {
-		var rr *ResourceRecord
+		var rr ResourceRecord
 		if err := rr.decode(r); err != nil {
 			return Packet{}, err
 		}
-		recs = append(recs, *rr)
+		recs = append(recs, rr)
 	}
 
 	copy(answers, recs[:h.answerCount])
 	copy(authorities, recs[h.answerCount:h.answerCount+h.authorityCount])
 	copy(additional, recs[h.answerCount+h.authorityCount:])
 
+	additional, opt, rcode, err := extractOPT(additional)
+	if err != nil {
+		return Packet{}, err
+	}
+	h.ResponseCode |= rcode
+
 	return Packet{
-		header:      *h,
+		header:      h,
 		Questions:   questions,
 		Answers:     answers,
 		Authorities: authorities,
 		Additional:  additional,
+		OPT:         opt,
 	}, nil
 }
@@ -2,6 +2,7 @@ package dns
 
 const (
 	maxUDPPacketSize = 512
+	maxTCPPacketSize = 65535
 
 	udpPacket packetType = "udp"
 	tcpPacket packetType = "tcp"
@@ -15,4 +16,7 @@ type Packet struct {
 	Answers     []ResourceRecord
 	Authorities []ResourceRecord
 	Additional  []ResourceRecord
+	// OPT is the EDNS(0) pseudo-record of the packet, or nil if the packet
+	// does not use EDNS. It is not included in Additional.
+	OPT *OPT
 }
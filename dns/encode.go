@@ -7,27 +7,35 @@ import (
 
 type shouldWriteFunc func(*offsetWriter, *offsetWriter) bool
 
-func shouldWriteUDP(w, body *offsetWriter) bool {
-	return w.Len()+body.Len() > maxUDPPacketSize
-}
-
-func alwaysWrite(_, _ *offsetWriter) bool {
-	return true
-}
-
+// EncodeTCPPacket encodes the packet for sending over TCP, where messages can
+// be up to 65535 bytes long.
 func EncodeTCPPacket(p Packet) (EncodePacketResult, error) {
-	return encode(p, alwaysWrite)
+	return encode(p, maxTCPPacketSize)
 }
 
+// EncodeUDPPacket encodes the packet for sending over UDP. The packet is
+// truncated to fit in the UDP payload size of its OPT record, or 512 bytes if
+// it has none.
 func EncodeUDPPacket(p Packet) (EncodePacketResult, error) {
-	return encode(p, shouldWriteUDP)
+	return encode(p, p.udpPayloadSize())
 }
 
-func encode(p Packet, shouldWrite shouldWriteFunc) (EncodePacketResult, error) {
+func encode(p Packet, maxSize int) (EncodePacketResult, error) {
 	body := newOffsetWriter(headerLen)
 	cache := newCompressionCache()
 	trunc := false
 
+	// The OPT record is written even if the packet is truncated, so room is
+	// reserved for it at the end of the packet.
+	opt, err := p.encodeOPT()
+	if err != nil {
+		return EncodePacketResult{}, err
+	}
+
+	shouldWrite := func(w, body *offsetWriter) bool {
+		return headerLen+body.Len()+w.Len()+len(opt) <= maxSize
+	}
+
 	var qCnt int
 	for _, q := range p.Questions {
 		qw := newOffsetWriter(body.Offset())
@@ -35,10 +43,10 @@ func encode(p Packet, shouldWrite shouldWriteFunc) (EncodePacketResult, error) {
 		if err != nil {
 			return EncodePacketResult{}, err
 		}
-		if shouldWriteUDP(qw, body) {
+		if !shouldWrite(qw, body) {
 			cache.Revert()
 			trunc = true
-			continue
+			break
 		}
 		cache.Commit()
 		_, err = qw.WriteTo(body)
@@ -48,35 +56,44 @@ func encode(p Packet, shouldWrite shouldWriteFunc) (EncodePacketResult, error) {
 		qCnt++
 	}
 
-	anCnt, err := encodeRR(body, cache, shouldWrite, p.Answers)
-	if err != nil {
-		return EncodePacketResult{}, err
-	}
-	if anCnt < len(p.Answers) {
-		trunc = true
+	var anCnt, nsCnt, adCnt int
+	if !trunc {
+		anCnt, err = encodeRR(body, cache, shouldWrite, p.Answers)
+		if err != nil {
+			return EncodePacketResult{}, err
+		}
+		trunc = anCnt < len(p.Answers)
 	}
 
-	nsCnt, err := encodeRR(body, cache, shouldWrite, p.Authorities)
-	if err != nil {
-		return EncodePacketResult{}, err
-	}
-	if nsCnt < len(p.Authorities) {
-		trunc = true
+	if !trunc {
+		nsCnt, err = encodeRR(body, cache, shouldWrite, p.Authorities)
+		if err != nil {
+			return EncodePacketResult{}, err
+		}
+		trunc = nsCnt < len(p.Authorities)
 	}
 
-	adCnt, err := encodeRR(body, cache, shouldWrite, p.Additional)
-	if err != nil {
-		return EncodePacketResult{}, err
+	// Records missing from the additional section do not make the packet
+	// truncated (RFC 2181 §9).
+	if !trunc {
+		adCnt, err = encodeRR(body, cache, shouldWrite, p.Additional)
+		if err != nil {
+			return EncodePacketResult{}, err
+		}
 	}
-	if adCnt < len(p.Additional) {
-		trunc = true
+
+	if opt != nil {
+		if _, err := body.Write(opt); err != nil {
+			return EncodePacketResult{}, err
+		}
+		adCnt++
 	}
 
 	p.header.questionCount = uint16(qCnt)
 	p.header.answerCount = uint16(anCnt)
 	p.header.authorityCount = uint16(nsCnt)
 	p.header.additionalCount = uint16(adCnt)
-	p.header.Flags.Truncated = trunc
+	p.header.Flags.Truncated = p.header.Flags.Truncated || trunc
 
 	buf := newOffsetWriter(0)
 	if err := p.header.encode(buf, cache); err != nil {
@@ -102,9 +119,9 @@ func encodeRR(body *offsetWriter, c *compressionCache, shouldWrite shouldWriteFu
 		if err != nil {
 			return cnt, err
 		}
-		if shouldWrite(w, body) {
+		if !shouldWrite(w, body) {
 			c.Revert()
-			continue
+			break
 		}
 		c.Commit()
 		_, err = w.WriteTo(body)
@@ -121,15 +138,13 @@ type writeOffsetter interface {
 	Offset() int
 }
 
-type encoder interface {
-	encode(writeOffsetter, *compressionCache) error
-}
-
 type EncodePacketResult struct {
 	Bytes     []byte
 	Truncated bool
 }
 
+// compressionCache tracks the offsets of names already written so later
+// occurrences can be replaced with pointers. A nil cache disables compression.
 type compressionCache struct {
 	cache     map[string]int
 	lastAdded []string
@@ -143,11 +158,17 @@ func newCompressionCache() *compressionCache {
 }
 
 func (c *compressionCache) Set(n Name, i int) {
+	if c == nil {
+		return
+	}
 	c.cache[n.LowerString()] = i
 	c.lastAdded = append(c.lastAdded, n.LowerString())
 }
 
 func (c *compressionCache) Get(n Name) (int, bool) {
+	if c == nil {
+		return 0, false
+	}
 	o, exists := c.cache[n.LowerString()]
 	return o, exists
 }
@@ -156,6 +177,7 @@ func (c *compressionCache) Revert() {
 	for _, k := range c.lastAdded {
 		delete(c.cache, k)
 	}
+	c.lastAdded = []string{}
 }
 
 func (c *compressionCache) Commit() {
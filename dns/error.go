@@ -1,8 +1,9 @@
 package dns
 
 const (
-	dataNotFoundErrorDescription = "data not found"
-	nameErrorDescription         = "name does not exist"
+	dataNotFoundErrorDescription  = "data not found"
+	nameErrorDescription          = "name does not exist"
+	serverFailureErrorDescription = "server failure"
 )
 
 type Error struct {
@@ -10,6 +11,10 @@ type Error struct {
 	IsTemporary bool
 }
 
+func (e Error) Error() string {
+	return e.Description
+}
+
 func NewDataNotFoundError() Error {
 	return Error{
 		Description: dataNotFoundErrorDescription,
@@ -23,3 +28,10 @@ func NewNameError() Error {
 		IsTemporary: false,
 	}
 }
+
+func NewServerFailureError() Error {
+	return Error{
+		Description: serverFailureErrorDescription,
+		IsTemporary: true,
+	}
+}
@@ -65,7 +65,7 @@ func (h *header) encode(w writeOffsetter, c *compressionCache) error {
 	b = addBits(b, 0, 1) // Write reserved bit set to 0
 	b = addBits(b, encodeBool(h.Flags.AuthenticData), 1)
 	b = addBits(b, encodeBool(h.Flags.CheckingDisabled), 1)
-	b = addBits(b, byte(h.ResponseCode), 4)
+	b = addBits(b, byte(uint16(h.ResponseCode)&maskRCode), 4)
 
 	if err := writeByte(w, b); err != nil {
 		return err
@@ -82,7 +82,7 @@ func (h *header) encode(w writeOffsetter, c *compressionCache) error {
 }
 
 func addBits(dst byte, src byte, numBits int) byte {
-	return (dst << numBits) & src
+	return (dst << numBits) | src
 }
 
 func encodeBool(b bool) byte {
@@ -104,7 +104,7 @@ func (h *header) decode(r readSeekOffsetter) error {
 	}
 	metadata := headerSections[1]
 
-	h = &header{
+	*h = header{
 		ID:     headerSections[0],
 		Type:   getQR(metadata),
 		Opcode: getOpCode(metadata),
@@ -0,0 +1,39 @@
+package dns
+
+// An HINFO record
+type HINFORecordData struct {
+	CPU string
+	OS  string
+}
+
+func (h HINFORecordData) EncodeRecordData(w *RecordDataWriter) error {
+	if err := w.WriteCharacterString(h.CPU); err != nil {
+		return err
+	}
+	return w.WriteCharacterString(h.OS)
+}
+
+func (h *HINFORecordData) DecodeRecordData(r *RecordDataReader) error {
+	var err error
+	if h.CPU, err = r.ReadCharacterString(); err != nil {
+		return err
+	}
+	h.OS, err = r.ReadCharacterString()
+	return err
+}
+
+func (h HINFORecordData) String() string {
+	return quoteCharacterString(h.CPU) + " " + quoteCharacterString(h.OS)
+}
+
+func (h *HINFORecordData) ParseRecordData(fields []string, origin Name) error {
+	if err := checkFieldCount(fields, 2, TypeHINFO); err != nil {
+		return err
+	}
+	var err error
+	if h.CPU, err = parseCharacterString(fields[0]); err != nil {
+		return err
+	}
+	h.OS, err = parseCharacterString(fields[1])
+	return err
+}
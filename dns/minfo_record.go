@@ -0,0 +1,44 @@
+package dns
+
+import "fmt"
+
+// A MINFO record
+type MINFORecordData struct {
+	// A mailbox responsible for the mailing list or mailbox
+	RMailBX Name
+	// A mailbox to receive error messages related to the mailing list or
+	// mailbox
+	EMailBX Name
+}
+
+func (m MINFORecordData) EncodeRecordData(w *RecordDataWriter) error {
+	if err := w.WriteName(m.RMailBX); err != nil {
+		return err
+	}
+	return w.WriteName(m.EMailBX)
+}
+
+func (m *MINFORecordData) DecodeRecordData(r *RecordDataReader) error {
+	var err error
+	if m.RMailBX, err = r.ReadName(); err != nil {
+		return err
+	}
+	m.EMailBX, err = r.ReadName()
+	return err
+}
+
+func (m MINFORecordData) String() string {
+	return fmt.Sprintf("%s %s", m.RMailBX, m.EMailBX)
+}
+
+func (m *MINFORecordData) ParseRecordData(fields []string, origin Name) error {
+	if err := checkFieldCount(fields, 2, TypeMINFO); err != nil {
+		return err
+	}
+	var err error
+	if m.RMailBX, err = ParseName(fields[0], origin); err != nil {
+		return err
+	}
+	m.EMailBX, err = ParseName(fields[1], origin)
+	return err
+}
@@ -0,0 +1,41 @@
+package dns
+
+import "fmt"
+
+// An MX record
+type MXRecordData struct {
+	Preference uint16
+	Exchange   Name
+}
+
+func (m MXRecordData) EncodeRecordData(w *RecordDataWriter) error {
+	if err := w.WriteUint16(m.Preference); err != nil {
+		return err
+	}
+	return w.WriteName(m.Exchange)
+}
+
+func (m *MXRecordData) DecodeRecordData(r *RecordDataReader) error {
+	var err error
+	if m.Preference, err = r.ReadUint16(); err != nil {
+		return err
+	}
+	m.Exchange, err = r.ReadName()
+	return err
+}
+
+func (m MXRecordData) String() string {
+	return fmt.Sprintf("%d %s", m.Preference, m.Exchange)
+}
+
+func (m *MXRecordData) ParseRecordData(fields []string, origin Name) error {
+	if err := checkFieldCount(fields, 2, TypeMX); err != nil {
+		return err
+	}
+	var err error
+	if m.Preference, err = parseUint16(fields[0]); err != nil {
+		return err
+	}
+	m.Exchange, err = ParseName(fields[1], origin)
+	return err
+}
@@ -3,23 +3,149 @@ package dns
 import (
 	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"net"
 	"strings"
 )
 
 const (
 	nameTerminator byte = 0
+
+	maxLabelLength = 63
+	maxNameLength  = 255
+
+	// maxCompressionPointers bounds the number of pointers followed while
+	// decoding a single name so that pointer loops cannot recurse forever.
+	maxCompressionPointers = 64
 )
 
 type Name [][]byte
 
 func NewName(s string) Name {
+	if s == "" || s == "." {
+		return Name{{}}
+	}
 	if s[len(s)-1] != '.' {
 		s = s + "."
 	}
 	return bytes.Split([]byte(s), []byte{'.'})
 }
 
+// ReverseName returns the name under in-addr.arpa or ip6.arpa used to look up
+// the PTR record of an address (RFC 1035 §3.5, RFC 3596 §2.5).
+func ReverseName(ip net.IP) (Name, error) {
+	if ip4 := ip.To4(); ip4 != nil {
+		return NewName(fmt.Sprintf("%d.%d.%d.%d.in-addr.arpa.", ip4[3], ip4[2], ip4[1], ip4[0])), nil
+	}
+	ip6 := ip.To16()
+	if ip6 == nil {
+		return nil, fmt.Errorf("invalid ip address %v", ip)
+	}
+	var b strings.Builder
+	for i := len(ip6) - 1; i >= 0; i-- {
+		fmt.Fprintf(&b, "%x.%x.", ip6[i]&0xF, ip6[i]>>4)
+	}
+	b.WriteString("ip6.arpa.")
+	return NewName(b.String()), nil
+}
+
+// ParseName parses a name in presentation format, where labels may contain
+// escaped characters (\X or \DDD). Names that do not end in a dot are
+// relative to origin, and @ is the origin itself.
+func ParseName(s string, origin Name) (Name, error) {
+	if s == "@" {
+		if origin == nil {
+			return nil, errors.New("@ used without an origin")
+		}
+		return origin, nil
+	}
+	if s == "." {
+		return Name{{}}, nil
+	}
+	if s == "" {
+		return nil, errors.New("empty name")
+	}
+
+	name := Name{}
+	label := []byte{}
+	absolute := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '\\':
+			b, n, err := unescape(s[i:])
+			if err != nil {
+				return nil, err
+			}
+			label = append(label, b)
+			i += n - 1
+		case c == '.':
+			if len(label) == 0 {
+				return nil, fmt.Errorf("invalid name %q: empty label", s)
+			}
+			name = append(name, label)
+			label = []byte{}
+			absolute = i == len(s)-1
+		default:
+			label = append(label, c)
+		}
+	}
+	if len(label) > 0 {
+		name = append(name, label)
+	}
+
+	if absolute {
+		name = append(name, []byte{})
+	} else {
+		if origin == nil {
+			return nil, fmt.Errorf("relative name %q used without an origin", s)
+		}
+		if !origin.IsRoot() {
+			name = append(name, origin...)
+		} else {
+			name = append(name, []byte{})
+		}
+	}
+
+	length := 0
+	for _, l := range name {
+		if len(l) > maxLabelLength {
+			return nil, fmt.Errorf("invalid name %q: label longer than %d bytes", s, maxLabelLength)
+		}
+		length += len(l) + 1
+	}
+	if length > maxNameLength {
+		return nil, fmt.Errorf("invalid name %q: longer than %d bytes", s, maxNameLength)
+	}
+
+	return name, nil
+}
+
+// unescape decodes the escape sequence at the start of s, either \DDD where
+// DDD is a decimal byte value or \X for the character X. It returns the byte
+// and the length of the sequence.
+func unescape(s string) (byte, int, error) {
+	if len(s) < 2 {
+		return 0, 0, errors.New("invalid escape sequence at end of string")
+	}
+	if !isDigit(s[1]) {
+		return s[1], 2, nil
+	}
+	if len(s) < 4 || !isDigit(s[2]) || !isDigit(s[3]) {
+		return 0, 0, errors.New("invalid escape sequence")
+	}
+	v := int(s[1]-'0')*100 + int(s[2]-'0')*10 + int(s[3]-'0')
+	if v > 255 {
+		return 0, 0, fmt.Errorf("invalid escape sequence %q", s[:4])
+	}
+	return byte(v), 4, nil
+}
+
+func isDigit(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
 func (n Name) Parent() Name {
 	if len(n) == 0 {
 		return Name{{}}
@@ -38,26 +164,59 @@ func (n Name) HasParent() bool {
 	return len(n) > 0
 }
 
+// IsRoot reports whether n is the root name.
+func (n Name) IsRoot() bool {
+	return len(n) == 0 || (len(n) == 1 && len(n[0]) == 0)
+}
+
+// IsSubdomainOf reports whether n is equal to or below p.
+func (n Name) IsSubdomainOf(p Name) bool {
+	if len(p) > len(n) {
+		return false
+	}
+	offset := len(n) - len(p)
+	for i := range p {
+		if !bytes.EqualFold(n[offset+i], p[i]) {
+			return false
+		}
+	}
+	return true
+}
+
 func (n Name) Equals(x Name) bool {
 	return n.LowerString() == x.LowerString()
 }
 
+// String returns the name in presentation format, with special characters in
+// its labels escaped.
 func (n Name) String() string {
-	return string(bytes.Join(n, []byte{'.'}))
+	if n.IsRoot() {
+		return "."
+	}
+	labels := make([]string, len(n))
+	for i, l := range n {
+		labels[i] = escapeLabel(l)
+	}
+	return strings.Join(labels, ".")
 }
 
 func (n Name) LowerString() string {
 	return strings.ToLower(n.String())
 }
 
+// lower returns a copy of the name with its letters in lower case.
+func (n Name) lower() Name {
+	l := make(Name, len(n))
+	for i, label := range n {
+		l[i] = bytes.ToLower(label)
+	}
+	return l
+}
+
 func (n Name) encode(w writeOffsetter, c *compressionCache) error {
 	name := make(Name, len(n))
 	copy(name, n)
-	for {
-		if !name.HasParent() {
-			break
-		}
-
+	for !name.IsRoot() {
 		initialOffset := w.Offset()
 
 		pointerOffset, exists := c.Get(name)
@@ -68,7 +227,7 @@ func (n Name) encode(w writeOffsetter, c *compressionCache) error {
 
 		label := name.LabelAt(0)
 
-		if err := writeByte(w, len(label)); err != nil {
+		if err := writeByte(w, byte(len(label))); err != nil {
 			return err
 		}
 
@@ -77,11 +236,15 @@ func (n Name) encode(w writeOffsetter, c *compressionCache) error {
 			return err
 		}
 
-		c.Set(name, initialOffset)
+		// Names further into the message than a pointer can reach are not
+		// compressed against.
+		if initialOffset <= maxPointerOffset {
+			c.Set(name, initialOffset)
+		}
 
 		name = name.Parent()
 	}
-	return nil
+	return writeByte(w, nameTerminator)
 }
 
 func (n *Name) decode(r readSeekOffsetter) error {
@@ -94,7 +257,7 @@ func (n *Name) decode(r readSeekOffsetter) error {
 		}
 
 		if isNameTerminator(b) {
-			name = append(name, []byte{0})
+			name = append(name, []byte{})
 			return name, nil
 		} else if isLabelSignal(b) {
 			label, err := readNBytes(r, int(b))
@@ -105,7 +268,7 @@ func (n *Name) decode(r readSeekOffsetter) error {
 			return decodeLabels(name, ptrCnt)
 		} else if isPointerSignal(b) {
 			if ptrCnt == 0 {
-				return Name{}, errors.New("invalid packet: multiple sequential pointers")
+				return Name{}, errors.New("invalid packet: too many compression pointers")
 			}
 			secondOctet, err := readByte(r)
 			if err != nil {
@@ -136,7 +299,7 @@ func (n *Name) decode(r readSeekOffsetter) error {
 		}
 	}
 
-	name, err := decodeLabels(Name{}, 1)
+	name, err := decodeLabels(Name{}, maxCompressionPointers)
 
 	*n = name
 
@@ -0,0 +1,17 @@
+package dns
+
+// A NULL record
+type NULLRecordData struct {
+	Data []byte
+}
+
+func (n NULLRecordData) EncodeRecordData(w *RecordDataWriter) error {
+	_, err := w.Write(n.Data)
+	return err
+}
+
+func (n *NULLRecordData) DecodeRecordData(r *RecordDataReader) error {
+	var err error
+	n.Data, err = r.ReadBytes(r.Len())
+	return err
+}
@@ -0,0 +1,162 @@
+package dns
+
+import "errors"
+
+const (
+	// DefaultUDPPayloadSize is the EDNS UDP payload size recommended by DNS
+	// Flag Day 2020, which avoids IP fragmentation on most networks.
+	DefaultUDPPayloadSize = 1232
+
+	maskDO uint32 = 1 << 15
+
+	maxResponseCode = 0xFFF
+)
+
+// OPT holds the EDNS(0) information carried by the OPT pseudo-record of a
+// packet (RFC 6891).
+type OPT struct {
+	// UDPPayloadSize is the largest UDP payload the sender can reassemble.
+	UDPPayloadSize uint16
+	// Version is the EDNS version implemented by the sender.
+	Version uint8
+	// DNSSECOK is the DO bit, set when the sender can handle DNSSEC records.
+	DNSSECOK bool
+	Options  []EDNSOption
+}
+
+// An EDNSOption is a single option in the RDATA of an OPT record.
+type EDNSOption struct {
+	Code uint16
+	Data []byte
+}
+
+// The RDATA of an OPT record
+type OPTRecordData struct {
+	Options []EDNSOption
+}
+
+func (o *OPTRecordData) EncodeRecordData(w *RecordDataWriter) error {
+	for _, opt := range o.Options {
+		if err := w.WriteUint16(opt.Code); err != nil {
+			return err
+		}
+		if err := w.WriteUint16(uint16(len(opt.Data))); err != nil {
+			return err
+		}
+		if _, err := w.Write(opt.Data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (o *OPTRecordData) DecodeRecordData(r *RecordDataReader) error {
+	o.Options = []EDNSOption{}
+	for r.Len() > 0 {
+		code, err := r.ReadUint16()
+		if err != nil {
+			return err
+		}
+		length, err := r.ReadUint16()
+		if err != nil {
+			return err
+		}
+		data, err := r.ReadBytes(int(length))
+		if err != nil {
+			return err
+		}
+
+		o.Options = append(o.Options, EDNSOption{Code: code, Data: data})
+	}
+	return nil
+}
+
+// record builds the OPT pseudo-record, which also carries the upper eight
+// bits of the extended response code.
+func (o OPT) record(rcode ResponseCode) ResourceRecord {
+	ttl := uint32(rcode>>4)<<24 | uint32(o.Version)<<16
+	if o.DNSSECOK {
+		ttl |= maskDO
+	}
+
+	return ResourceRecord{
+		Name:  Name{{}},
+		Type:  TypeOPT,
+		Class: Class(o.UDPPayloadSize),
+		TTL:   ttl,
+		Data:  &OPTRecordData{Options: o.Options},
+	}
+}
+
+// newOPT reads the EDNS information from an OPT record, along with the upper
+// eight bits of the extended response code.
+func newOPT(rr ResourceRecord) (*OPT, ResponseCode, error) {
+	if !rr.Name.IsRoot() {
+		return nil, 0, errors.New("invalid packet: opt record must be owned by the root")
+	}
+
+	opt := &OPT{
+		UDPPayloadSize: uint16(rr.Class),
+		Version:        uint8(rr.TTL >> 16),
+		DNSSECOK:       rr.TTL&maskDO > 0,
+	}
+	if data, ok := rr.Data.(*OPTRecordData); ok {
+		opt.Options = data.Options
+	}
+
+	return opt, ResponseCode(rr.TTL>>24) << 4, nil
+}
+
+// extractOPT removes the OPT record from the additional section.
+func extractOPT(additional []ResourceRecord) ([]ResourceRecord, *OPT, ResponseCode, error) {
+	var (
+		opt   *OPT
+		rcode ResponseCode
+	)
+	records := []ResourceRecord{}
+	for _, rr := range additional {
+		if rr.Type != TypeOPT {
+			records = append(records, rr)
+			continue
+		}
+
+		if opt != nil {
+			return nil, nil, 0, errors.New("invalid packet: multiple opt records")
+		}
+
+		var err error
+		if opt, rcode, err = newOPT(rr); err != nil {
+			return nil, nil, 0, err
+		}
+	}
+	return records, opt, rcode, nil
+}
+
+func (p Packet) udpPayloadSize() int {
+	if p.OPT == nil || p.OPT.UDPPayloadSize < maxUDPPacketSize {
+		return maxUDPPacketSize
+	}
+	return int(p.OPT.UDPPayloadSize)
+}
+
+// encodeOPT encodes the OPT record of the packet. Packets without one can only
+// carry response codes that fit in the header.
+func (p Packet) encodeOPT() ([]byte, error) {
+	if p.OPT == nil {
+		if uint16(p.ResponseCode) > maskRCode {
+			return nil, errors.New("extended response code requires an opt record")
+		}
+		return nil, nil
+	}
+
+	if p.ResponseCode > maxResponseCode {
+		return nil, errors.New("invalid response code")
+	}
+
+	rr := p.OPT.record(p.ResponseCode)
+	w := newOffsetWriter(0)
+	if err := rr.encode(w, newCompressionCache()); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
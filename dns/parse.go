@@ -0,0 +1,153 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// A RecordDataParser parses RDATA from the fields of its presentation format,
+// as found in master files (RFC 1035 §5). Quoted fields have had their quotes
+// removed but escape sequences are left in place. Relative names in the data
+// are relative to origin.
+type RecordDataParser interface {
+	ParseRecordData(fields []string, origin Name) error
+}
+
+// ParseRecordData parses the RDATA of a record of type t from the fields of
+// its presentation format. Data of any type can be given in the generic
+// format of RFC 3597 §5.
+//
+// Since the quotes have been removed from the fields, a quoted "\#" is taken
+// as the start of the generic format too. Callers that know which fields were
+// quoted should use ParseTypeRecordData when the first field was.
+func ParseRecordData(t Type, fields []string, origin Name) (RecordData, error) {
+	if len(fields) > 0 && fields[0] == unknownRecordDataPrefix {
+		return parseGenericRecordData(t, fields)
+	}
+	return ParseTypeRecordData(t, fields, origin)
+}
+
+// ParseTypeRecordData parses the RDATA of a record of type t from the fields
+// of the presentation format specific to the type, never the generic format.
+func ParseTypeRecordData(t Type, fields []string, origin Name) (RecordData, error) {
+	data := newRecordData(t)
+	p, ok := data.(RecordDataParser)
+	if !ok {
+		return nil, fmt.Errorf("type %s can only be given in the generic format", t)
+	}
+
+	if err := p.ParseRecordData(fields, origin); err != nil {
+		return nil, err
+	}
+	return data, nil
+}
+
+// parseGenericRecordData parses data in the generic format and decodes it as
+// the type if it is supported.
+func parseGenericRecordData(t Type, fields []string) (RecordData, error) {
+	generic, err := parseUnknownRecordData(fields)
+	if err != nil {
+		return nil, err
+	}
+
+	data := newRecordData(t)
+	if _, ok := data.(*UnknownRecordData); ok {
+		return generic, nil
+	}
+
+	r := &RecordDataReader{r: newOffsetReader(generic.Data), end: len(generic.Data)}
+	if err := data.DecodeRecordData(r); err != nil {
+		return nil, err
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("record data is longer than the type allows")
+	}
+	return data, nil
+}
+
+// ParseTTL parses a TTL given either as a number of seconds or, as BIND
+// allows, as a sequence of numbers with the units w, d, h, m or s (e.g. 1h30m).
+func ParseTTL(s string) (uint32, error) {
+	if s == "" {
+		return 0, errors.New("empty ttl")
+	}
+	if n, err := strconv.ParseUint(s, 10, 32); err == nil {
+		return uint32(n), nil
+	}
+
+	var total, n uint64
+	digits := false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isDigit(c) {
+			n = n*10 + uint64(c-'0')
+			digits = true
+			continue
+		}
+
+		var unit uint64
+		switch c {
+		case 'w', 'W':
+			unit = 7 * 24 * 60 * 60
+		case 'd', 'D':
+			unit = 24 * 60 * 60
+		case 'h', 'H':
+			unit = 60 * 60
+		case 'm', 'M':
+			unit = 60
+		case 's', 'S':
+			unit = 1
+		default:
+			return 0, fmt.Errorf("invalid ttl %q", s)
+		}
+		if !digits {
+			return 0, fmt.Errorf("invalid ttl %q", s)
+		}
+		total += n * unit
+		n, digits = 0, false
+	}
+	if digits {
+		return 0, fmt.Errorf("invalid ttl %q", s)
+	}
+	if total > 1<<32-1 {
+		return 0, fmt.Errorf("ttl %q out of range", s)
+	}
+	return uint32(total), nil
+}
+
+// parseCharacterString decodes the escape sequences in a <character-string>.
+func parseCharacterString(s string) (string, error) {
+	b := make([]byte, 0, len(s))
+	for i := 0; i < len(s); i++ {
+		if s[i] != '\\' {
+			b = append(b, s[i])
+			continue
+		}
+		c, n, err := unescape(s[i:])
+		if err != nil {
+			return "", err
+		}
+		b = append(b, c)
+		i += n - 1
+	}
+	if len(b) > 255 {
+		return "", errors.New("character string longer than 255 bytes")
+	}
+	return string(b), nil
+}
+
+func parseUint16(s string) (uint16, error) {
+	n, err := strconv.ParseUint(s, 10, 16)
+	if err != nil {
+		return 0, fmt.Errorf("invalid number %q", s)
+	}
+	return uint16(n), nil
+}
+
+func checkFieldCount(fields []string, n int, t Type) error {
+	if len(fields) != n {
+		return fmt.Errorf("%s record needs %d fields, found %d", t, n, len(fields))
+	}
+	return nil
+}
@@ -0,0 +1,202 @@
+package dns
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	opcodeNames = map[byte]string{
+		0: "QUERY",
+		1: "IQUERY",
+		2: "STATUS",
+		4: "NOTIFY",
+		5: "UPDATE",
+	}
+
+	responseCodeNames = map[ResponseCode]string{
+		ResponseCodeNoError:          "NOERROR",
+		ReponseCodeFormError:         "FORMERR",
+		ResponseCodeServerFailure:    "SERVFAIL",
+		ResponseCodeNXDomain:         "NXDOMAIN",
+		ResponseCodeNotImplemented:   "NOTIMP",
+		ReponseCodeRefused:           "REFUSED",
+		ResponseCodeYXDomain:         "YXDOMAIN",
+		ResponseCodeYXRRSet:          "YXRRSET",
+		ResponseCodeNXRRSet:          "NXRRSET",
+		ResponseCodeNotAuthoritative: "NOTAUTH",
+		ResponseCodeNotZone:          "NOTZONE",
+		ResponseCodeDSOTypeNI:        "DSOTYPENI",
+		ResponseCodeBadOptVersion:    "BADVERS",
+		ResponseCodeBadKey:           "BADKEY",
+		ResponseCodeBadTime:          "BADTIME",
+		ResponseCodeCodeBadMode:      "BADMODE",
+		ResponseCodeBadName:          "BADNAME",
+		ResponseCodeBadAlgorithm:     "BADALG",
+		ResponseCodeBadTruncation:    "BADTRUNC",
+		ResponseCodeBadCookie:        "BADCOOKIE",
+	}
+)
+
+// String returns the mnemonic of the response code, or RCODE followed by its
+// number for codes without one.
+func (rc ResponseCode) String() string {
+	if name, ok := responseCodeNames[rc]; ok {
+		return name
+	}
+	return "RCODE" + strconv.Itoa(int(rc))
+}
+
+// String returns the packet in the format dig prints responses in: the header,
+// the EDNS information and each section with its records in master file
+// syntax.
+func (p Packet) String() string {
+	var b strings.Builder
+
+	opcode, ok := opcodeNames[p.Opcode]
+	if !ok {
+		opcode = "OPCODE" + strconv.Itoa(int(p.Opcode))
+	}
+	fmt.Fprintf(&b, ";; ->>HEADER<<- opcode: %s, status: %s, id: %d\n", opcode, p.ResponseCode, p.ID)
+
+	additional := len(p.Additional)
+	if p.OPT != nil {
+		additional++
+	}
+	fmt.Fprintf(&b, ";; flags: %s; QUERY: %d, ANSWER: %d, AUTHORITY: %d, ADDITIONAL: %d\n",
+		p.flagsString(), len(p.Questions), len(p.Answers), len(p.Authorities), additional)
+
+	if p.OPT != nil {
+		b.WriteString("\n;; OPT PSEUDOSECTION:\n")
+		b.WriteString(p.OPT.String())
+		b.WriteString("\n")
+	}
+
+	if len(p.Questions) > 0 {
+		b.WriteString("\n;; QUESTION SECTION:\n")
+		for _, q := range p.Questions {
+			b.WriteString(q.String())
+			b.WriteString("\n")
+		}
+	}
+
+	sections := []struct {
+		name    string
+		records []ResourceRecord
+	}{
+		{"ANSWER", p.Answers},
+		{"AUTHORITY", p.Authorities},
+		{"ADDITIONAL", p.Additional},
+	}
+	for _, s := range sections {
+		if len(s.records) == 0 {
+			continue
+		}
+		fmt.Fprintf(&b, "\n;; %s SECTION:\n", s.name)
+		for _, rr := range s.records {
+			b.WriteString(rr.String())
+			b.WriteString("\n")
+		}
+	}
+
+	return b.String()
+}
+
+func (p Packet) flagsString() string {
+	flags := []string{}
+	add := func(set bool, name string) {
+		if set {
+			flags = append(flags, name)
+		}
+	}
+	add(p.Type, "qr")
+	add(p.Flags.AuthoritativeAnswer, "aa")
+	add(p.Flags.Truncated, "tc")
+	add(p.Flags.RecursionDesired, "rd")
+	add(p.Flags.RecursionAvailable, "ra")
+	add(p.Flags.AuthenticData, "ad")
+	add(p.Flags.CheckingDisabled, "cd")
+	return strings.Join(flags, " ")
+}
+
+// String returns the EDNS information in the format dig prints it in.
+func (o OPT) String() string {
+	flags := ""
+	if o.DNSSECOK {
+		flags = " do"
+	}
+	s := fmt.Sprintf("; EDNS: version: %d, flags:%s; udp: %d", o.Version, flags, o.UDPPayloadSize)
+	for _, opt := range o.Options {
+		s += fmt.Sprintf("\n; OPT=%d: %x", opt.Code, opt.Data)
+	}
+	return s
+}
+
+// String returns the question as a comment line, as in the question section
+// printed by dig.
+func (q Question) String() string {
+	return fmt.Sprintf(";%s\t\t%s\t%s", q.Name, q.Class, q.Type)
+}
+
+// String returns the record in master file syntax. The RDATA of types without
+// a presentation format of their own is written in the generic format of
+// RFC 3597 §5.
+func (rr ResourceRecord) String() string {
+	return fmt.Sprintf("%s\t%d\t%s\t%s\t%s", rr.Name, rr.TTL, rr.Class, rr.Type, FormatRecordData(rr.Data))
+}
+
+// FormatRecordData returns RDATA in presentation format, using the generic
+// format of RFC 3597 §5 for types without one of their own.
+func FormatRecordData(data RecordData) string {
+	if s, ok := data.(fmt.Stringer); ok {
+		return s.String()
+	}
+	if data == nil {
+		return UnknownRecordData{}.String()
+	}
+
+	w := newOffsetWriter(0)
+	if err := data.EncodeRecordData(&RecordDataWriter{w: w}); err != nil {
+		return fmt.Sprintf("; invalid record data: %v", err)
+	}
+	return UnknownRecordData{Data: w.Bytes()}.String()
+}
+
+// escapeLabel escapes the characters of a label that have a special meaning
+// in master files, and those that are not printable.
+func escapeLabel(label []byte) string {
+	var b strings.Builder
+	for _, c := range label {
+		switch {
+		case c == '.' || c == '\\' || c == '"' || c == '(' || c == ')' || c == ';' || c == '@' || c == '$':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c <= ' ' || c >= 0x7f:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String()
+}
+
+// quoteCharacterString writes a <character-string> as a quoted string.
+func quoteCharacterString(s string) string {
+	var b strings.Builder
+	b.WriteByte('"')
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < ' ' || c >= 0x7f:
+			fmt.Fprintf(&b, "\\%03d", c)
+		default:
+			b.WriteByte(c)
+		}
+	}
+	b.WriteByte('"')
+	return b.String()
+}
@@ -103,3 +103,16 @@ func readUint64(r io.Reader) (uint64, error) {
 	err := readData(r, &b)
 	return b, err
 }
+
+// writeCharacterString writes s as a <character-string>, a length octet
+// followed by that number of characters.
+func writeCharacterString(w io.Writer, s string) error {
+	if len(s) > 255 {
+		return errors.New("character string too long")
+	}
+	if err := writeByte(w, byte(len(s))); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, s)
+	return err
+}
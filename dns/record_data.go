@@ -0,0 +1,204 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// RecordData is the RDATA of a resource record. The RDLENGTH is handled by
+// the resource record, so implementations only read and write the data.
+type RecordData interface {
+	EncodeRecordData(w *RecordDataWriter) error
+	DecodeRecordData(r *RecordDataReader) error
+}
+
+var (
+	recordTypesMu sync.RWMutex
+	// recordTypes maps each supported type to a constructor for its RDATA.
+	recordTypes = map[Type]func() RecordData{
+		TypeA:     func() RecordData { return &ARecordData{} },
+		TypeNS:    func() RecordData { return &NSRecordData{} },
+		TypeMD:    func() RecordData { return &MDRecordData{} },
+		TypeMF:    func() RecordData { return &MFRecordData{} },
+		TypeCNAME: func() RecordData { return &CNameRecordData{} },
+		TypeSOA:   func() RecordData { return &SOARecordData{} },
+		TypeMB:    func() RecordData { return &MBRecordData{} },
+		TypeMG:    func() RecordData { return &MGRecordData{} },
+		TypeMR:    func() RecordData { return &MRRecordData{} },
+		TypeNULL:  func() RecordData { return &NULLRecordData{} },
+		TypeWKS:   func() RecordData { return &WKSRecordData{} },
+		TypePTR:   func() RecordData { return &PTRRecordData{} },
+		TypeHINFO: func() RecordData { return &HINFORecordData{} },
+		TypeMINFO: func() RecordData { return &MINFORecordData{} },
+		TypeMX:    func() RecordData { return &MXRecordData{} },
+		TypeTXT:   func() RecordData { return &TXTRecordData{} },
+		TypeAAAA:  func() RecordData { return &AAAARecordData{} },
+		TypeSRV:   func() RecordData { return &SRVRecordData{} },
+		TypeOPT:   func() RecordData { return &OPTRecordData{} },
+	}
+
+	// compressibleTypes are the types whose RDATA may contain compressed
+	// names (RFC 3597 §4).
+	compressibleTypes = map[Type]bool{
+		TypeNS:    true,
+		TypeMD:    true,
+		TypeMF:    true,
+		TypeCNAME: true,
+		TypeSOA:   true,
+		TypeMB:    true,
+		TypeMG:    true,
+		TypeMR:    true,
+		TypePTR:   true,
+		TypeMINFO: true,
+		TypeMX:    true,
+	}
+)
+
+// RegisterType registers the constructor for the RDATA of a type, so that
+// records of the type are decoded into the RecordData it returns. Names in
+// the RDATA of registered types are never compressed.
+//
+// RegisterType panics if the type already has a constructor.
+func RegisterType(t Type, newData func() RecordData) {
+	recordTypesMu.Lock()
+	defer recordTypesMu.Unlock()
+
+	if newData == nil {
+		panic("dns: RegisterType constructor is nil")
+	}
+	if _, exists := recordTypes[t]; exists {
+		panic(fmt.Sprintf("dns: RegisterType called twice for type %d", t))
+	}
+	recordTypes[t] = newData
+}
+
+func newRecordData(t Type) RecordData {
+	recordTypesMu.RLock()
+	defer recordTypesMu.RUnlock()
+
+	newData, ok := recordTypes[t]
+	if !ok {
+		return &UnknownRecordData{}
+	}
+	return newData()
+}
+
+// A RecordDataWriter writes RDATA in wire format.
+type RecordDataWriter struct {
+	w writeOffsetter
+	// c is nil when names must not be compressed
+	c *compressionCache
+	// lower is set when names are written in lower case, for the canonical
+	// form of the RDATA
+	lower bool
+}
+
+func (w *RecordDataWriter) Write(b []byte) (int, error) {
+	return w.w.Write(b)
+}
+
+func (w *RecordDataWriter) WriteUint8(n uint8) error {
+	return writeUint8(w.w, n)
+}
+
+func (w *RecordDataWriter) WriteUint16(n uint16) error {
+	return writeUint16(w.w, n)
+}
+
+func (w *RecordDataWriter) WriteUint32(n uint32) error {
+	return writeUint32(w.w, n)
+}
+
+// WriteName writes a domain name, compressing it if the type allows it.
+func (w *RecordDataWriter) WriteName(n Name) error {
+	if w.lower {
+		n = n.lower()
+	}
+	return n.encode(w.w, w.c)
+}
+
+// WriteCharacterString writes s as a <character-string>, a length octet
+// followed by at most 255 characters.
+func (w *RecordDataWriter) WriteCharacterString(s string) error {
+	return writeCharacterString(w.w, s)
+}
+
+// CanonicalRecordData returns the RDATA in wire format, uncompressed and with
+// the letters of the names in it in lower case (RFC 4034 §6.2). Two RDATA are
+// the same exactly when their canonical forms are.
+func CanonicalRecordData(data RecordData) ([]byte, error) {
+	if data == nil {
+		return []byte{}, nil
+	}
+	w := newOffsetWriter(0)
+	if err := data.EncodeRecordData(&RecordDataWriter{w: w, lower: true}); err != nil {
+		return nil, err
+	}
+	return w.Bytes(), nil
+}
+
+// A RecordDataReader reads RDATA in wire format. Reads past the end of the
+// RDATA fail.
+type RecordDataReader struct {
+	r readSeekOffsetter
+	// end is the offset of the first byte after the RDATA
+	end int
+}
+
+var errRecordDataOverflow = errors.New("invalid packet: read past the end of rdata")
+
+// Len returns the number of unread bytes of the RDATA.
+func (r *RecordDataReader) Len() int {
+	return r.end - r.r.Offset()
+}
+
+func (r *RecordDataReader) ReadBytes(n int) ([]byte, error) {
+	if n > r.Len() {
+		return nil, errRecordDataOverflow
+	}
+	return readNBytes(r.r, n)
+}
+
+func (r *RecordDataReader) ReadUint8() (uint8, error) {
+	if r.Len() < 1 {
+		return 0, errRecordDataOverflow
+	}
+	return readUint8(r.r)
+}
+
+func (r *RecordDataReader) ReadUint16() (uint16, error) {
+	if r.Len() < 2 {
+		return 0, errRecordDataOverflow
+	}
+	return readUint16(r.r)
+}
+
+func (r *RecordDataReader) ReadUint32() (uint32, error) {
+	if r.Len() < 4 {
+		return 0, errRecordDataOverflow
+	}
+	return readUint32(r.r)
+}
+
+// ReadName reads a domain name, following any compression pointers.
+func (r *RecordDataReader) ReadName() (Name, error) {
+	var n Name
+	if err := n.decode(r.r); err != nil {
+		return nil, err
+	}
+	if r.Len() < 0 {
+		return nil, errRecordDataOverflow
+	}
+	return n, nil
+}
+
+// ReadCharacterString reads a <character-string>.
+func (r *RecordDataReader) ReadCharacterString() (string, error) {
+	l, err := r.ReadUint8()
+	if err != nil {
+		return "", err
+	}
+	b, err := r.ReadBytes(int(l))
+	return string(b), err
+}
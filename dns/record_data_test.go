@@ -0,0 +1,119 @@
+package dns
+
+import (
+	"bytes"
+	"encoding/hex"
+	"net"
+	"strings"
+	"testing"
+)
+
+// wire joins hex strings, which may contain spaces, and names written with
+// dots into RDATA in wire format. Parts containing a dot are names.
+func wire(parts ...string) []byte {
+	var b []byte
+	for _, p := range parts {
+		if strings.Contains(p, ".") {
+			for _, label := range NewName(p) {
+				b = append(b, byte(len(label)))
+				b = append(b, label...)
+			}
+			continue
+		}
+		h, err := hex.DecodeString(strings.ReplaceAll(p, " ", ""))
+		if err != nil {
+			panic(err)
+		}
+		b = append(b, h...)
+	}
+	return b
+}
+
+// roundTripSamples holds RDATA in wire format for every registered type.
+var roundTripSamples = map[Type][][]byte{
+	TypeA:     {wire("c0000201")},
+	TypeNS:    {wire("ns.example.")},
+	TypeMD:    {wire("md.example.")},
+	TypeMF:    {wire("mf.example.")},
+	TypeCNAME: {wire("alias.example."), wire(".")},
+	TypeSOA: {wire(
+		"ns.example.", "hostmaster.example.",
+		"00000001", "00000e10", "00000384", "00093a80", "00000e10",
+	)},
+	TypeMB:    {wire("mb.example.")},
+	TypeMG:    {wire("mg.example.")},
+	TypeMR:    {wire("mr.example.")},
+	TypeNULL:  {{}, wire("0102ff")},
+	TypeWKS:   {wire("c0000201 06"), wire("c0000201 06 000001")},
+	TypePTR:   {wire("host.example.")},
+	TypeHINFO: {wire("03 783836 05 6c696e7578"), wire("00 00")},
+	TypeMINFO: {wire("rmail.example.", "email.example.")},
+	TypeMX:    {wire("000a", "mail.example."), wire("0000", ".")},
+	TypeTXT:   {wire("05 68656c6c6f 00"), {}},
+	TypeAAAA: {
+		wire("20010db8 00000000 00000000 00000001"),
+		// An IPv4-mapped address.
+		wire("00000000 00000000 0000ffff c0000201"),
+	},
+	TypeSRV: {wire("0001 0002 0035", "ns.example.")},
+	TypeOPT: {{}, wire("000a 0008 0102030405060708")},
+}
+
+// TestRecordDataRoundTrip checks that the RDATA of every registered type is
+// written back exactly as it was read, so that any record received can be
+// sent on.
+func TestRecordDataRoundTrip(t *testing.T) {
+	for typ, newData := range recordTypes {
+		samples, ok := roundTripSamples[typ]
+		if !ok {
+			t.Errorf("no round trip samples for type %s", typ)
+			continue
+		}
+		for _, sample := range samples {
+			data := newData()
+			r := &RecordDataReader{r: newOffsetReader(sample), end: len(sample)}
+			if err := data.DecodeRecordData(r); err != nil {
+				t.Errorf("%s: DecodeRecordData(%x) error = %v", typ, sample, err)
+				continue
+			}
+			if r.Len() != 0 {
+				t.Errorf("%s: DecodeRecordData(%x) left %d bytes unread", typ, sample, r.Len())
+				continue
+			}
+
+			w := newOffsetWriter(0)
+			if err := data.EncodeRecordData(&RecordDataWriter{w: w}); err != nil {
+				t.Errorf("%s: EncodeRecordData(%x) error = %v", typ, sample, err)
+				continue
+			}
+			if got := w.Bytes(); !bytes.Equal(got, sample) {
+				t.Errorf("%s: round trip of %x = %x", typ, sample, got)
+			}
+		}
+	}
+}
+
+func TestAAAARecordDataString(t *testing.T) {
+	tests := []struct {
+		addr string
+		want string
+	}{
+		{addr: "2001:db8::1", want: "2001:db8::1"},
+		{addr: "::ffff:192.0.2.1", want: "::ffff:192.0.2.1"},
+	}
+
+	for _, tt := range tests {
+		data := AAAARecordData{Address: net.ParseIP(tt.addr)}
+		got := data.String()
+		if got != tt.want {
+			t.Errorf("String() = %q, want %q", got, tt.want)
+		}
+
+		var parsed AAAARecordData
+		if err := parsed.ParseRecordData([]string{got}, nil); err != nil {
+			t.Errorf("ParseRecordData(%q) error = %v", got, err)
+		} else if !parsed.Address.Equal(data.Address) {
+			t.Errorf("ParseRecordData(%q) = %v, want %v", got, parsed.Address, data.Address)
+		}
+	}
+}
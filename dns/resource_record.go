@@ -1,6 +1,11 @@
 package dns
 
-import "errors"
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
 
 const (
 	// TypeA An ipv4 host address
@@ -37,6 +42,10 @@ const (
 	TypeTXT Type = 16
 	// TypeAAAA An ipv6 host address
 	TypeAAAA Type = 28
+	// TypeSRV the location of the servers for a service
+	TypeSRV Type = 33
+	// TypeOPT An EDNS(0) pseudo-record
+	TypeOPT Type = 41
 
 	// QTypes
 
@@ -64,8 +73,73 @@ const (
 	QClassAny Class = 255
 )
 
+const maxRDLength = 65535
+
+var (
+	typeNames = map[Type]string{
+		TypeA:      "A",
+		TypeNS:     "NS",
+		TypeMD:     "MD",
+		TypeMF:     "MF",
+		TypeCNAME:  "CNAME",
+		TypeSOA:    "SOA",
+		TypeMB:     "MB",
+		TypeMG:     "MG",
+		TypeMR:     "MR",
+		TypeNULL:   "NULL",
+		TypeWKS:    "WKS",
+		TypePTR:    "PTR",
+		TypeHINFO:  "HINFO",
+		TypeMINFO:  "MINFO",
+		TypeMX:     "MX",
+		TypeTXT:    "TXT",
+		TypeAAAA:   "AAAA",
+		TypeSRV:    "SRV",
+		TypeOPT:    "OPT",
+		QTypeAXFR:  "AXFR",
+		QTypeMAILB: "MAILB",
+		QTypeMAILA: "MAILA",
+		QTypeAll:   "ANY",
+	}
+
+	classNames = map[Class]string{
+		ClassIN:    "IN",
+		ClassCS:    "CS",
+		ClassChaos: "CH",
+		ClassHS:    "HS",
+		QClassAny:  "ANY",
+	}
+)
+
 type Type uint16
 
+// String returns the mnemonic of the type, or TYPE followed by its number for
+// types without one (RFC 3597 §5).
+func (t Type) String() string {
+	if name, ok := typeNames[t]; ok {
+		return name
+	}
+	return "TYPE" + strconv.Itoa(int(t))
+}
+
+// ParseType parses a type mnemonic or the TYPE<n> form of RFC 3597 §5.
+func ParseType(s string) (Type, error) {
+	upper := strings.ToUpper(s)
+	for t, name := range typeNames {
+		if name == upper {
+			return t, nil
+		}
+	}
+	if upper == "*" {
+		return QTypeAll, nil
+	}
+	n, ok := parseGenericMnemonic(upper, "TYPE")
+	if !ok {
+		return 0, fmt.Errorf("unknown type %q", s)
+	}
+	return Type(n), nil
+}
+
 func (t Type) encode(w writeOffsetter, c *compressionCache) error {
 	return writeUint16(w, uint16(t))
 }
@@ -81,6 +155,42 @@ func (t *Type) decode(r readSeekOffsetter) error {
 
 type Class uint16
 
+// String returns the mnemonic of the class, or CLASS followed by its number
+// for classes without one (RFC 3597 §5).
+func (cl Class) String() string {
+	if name, ok := classNames[cl]; ok {
+		return name
+	}
+	return "CLASS" + strconv.Itoa(int(cl))
+}
+
+// ParseClass parses a class mnemonic or the CLASS<n> form of RFC 3597 §5.
+func ParseClass(s string) (Class, error) {
+	upper := strings.ToUpper(s)
+	for cl, name := range classNames {
+		if name == upper {
+			return cl, nil
+		}
+	}
+	n, ok := parseGenericMnemonic(upper, "CLASS")
+	if !ok {
+		return 0, fmt.Errorf("unknown class %q", s)
+	}
+	return Class(n), nil
+}
+
+// parseGenericMnemonic parses the number from mnemonics such as TYPE123.
+func parseGenericMnemonic(s, prefix string) (uint16, bool) {
+	if !strings.HasPrefix(s, prefix) {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(s[len(prefix):], 10, 16)
+	if err != nil {
+		return 0, false
+	}
+	return uint16(n), true
+}
+
 func (cl Class) encode(w writeOffsetter, c *compressionCache) error {
 	return writeUint16(w, uint16(cl))
 }
@@ -105,7 +215,7 @@ type ResourceRecord struct {
 
 	TTL uint32
 
-	Data interface{}
+	Data RecordData
 }
 
 func (rr *ResourceRecord) encode(w writeOffsetter, c *compressionCache) error {
@@ -125,12 +235,31 @@ func (rr *ResourceRecord) encode(w writeOffsetter, c *compressionCache) error {
 		return err
 	}
 
-	dEnc, ok := rr.Data.(encoder)
-	if !ok {
-		return errors.New("data does not implement encoder interface")
+	if rr.Data == nil {
+		return errors.New("resource record has no data")
+	}
+
+	// RDATA is written after the two byte RDLENGTH, so compression offsets
+	// must account for it.
+	buf := newOffsetWriter(w.Offset() + 2)
+	dw := &RecordDataWriter{w: buf}
+	if compressibleTypes[rr.Type] {
+		dw.c = c
+	}
+	if err := rr.Data.EncodeRecordData(dw); err != nil {
+		return err
+	}
+
+	if buf.Len() > maxRDLength {
+		return errors.New("rdata too long")
+	}
+
+	if err := writeUint16(w, uint16(buf.Len())); err != nil {
+		return err
 	}
 
-	return dEnc.encode(w, c)
+	_, err := buf.WriteTo(w)
+	return err
 }
 
 func (rr *ResourceRecord) decode(r readSeekOffsetter) error {
@@ -153,57 +282,47 @@ func (rr *ResourceRecord) decode(r readSeekOffsetter) error {
 	}
 	rr.TTL = ttl
 
-	data := getRecordData(rr.Type)
-	dec, ok := data.(decoder)
-	if !ok {
-		return errors.New("invalid record data")
+	rdLength, err := readUint16(r)
+	if err != nil {
+		return err
 	}
 
-	if err := dec.decode(r); err != nil {
+	dr := &RecordDataReader{r: r, end: r.Offset() + int(rdLength)}
+	data := newRecordData(rr.Type)
+	if err := data.DecodeRecordData(dr); err != nil {
 		return err
 	}
 
-	rr.Data = dec
-
-	return nil
-}
-
-func getRecordData(t Type) interface{} {
-	switch t {
-	case TypeA:
-		return ARecordData{}
-	case TypeNS:
-		return NSRecordData{}
-	default:
-		return unsupportedRecordData{}
+	if dr.Len() != 0 {
+		return errors.New("invalid packet: rdata does not match rdlength")
 	}
 
+	rr.Data = data
+
+	return nil
 }
 
 type nameRecordData struct {
 	Name Name
 }
 
-func (n *nameRecordData) encode(w writeOffsetter, c *compressionCache) error {
-	buf := newOffsetWriter(w.Offset())
-	if err := n.Name.encode(buf, c); err != nil {
-		return err
-	}
-	if err := writeUint16(w, buf.Len()); err != nil {
-		return err
-	}
-
-	_, err := buf.WriteTo(w)
+func (n *nameRecordData) EncodeRecordData(w *RecordDataWriter) error {
+	return w.WriteName(n.Name)
+}
 
+func (n *nameRecordData) DecodeRecordData(r *RecordDataReader) error {
+	var err error
+	n.Name, err = r.ReadName()
 	return err
 }
 
-func (n *nameRecordData) decode(r readSeekOffsetter) error {
-	_, err := readUint16(r)
-	if err != nil {
-		return err
+func (n *nameRecordData) ParseRecordData(fields []string, origin Name) error {
+	if len(fields) != 1 {
+		return fmt.Errorf("expected a single name, found %d fields", len(fields))
 	}
-	return n.Name.decode(r)
+	var err error
+	n.Name, err = ParseName(fields[0], origin)
+	return err
 }
 
 func (n nameRecordData) String() string {
@@ -221,3 +340,23 @@ type CNameRecordData struct {
 type PTRRecordData struct {
 	nameRecordData
 }
+
+type MDRecordData struct {
+	nameRecordData
+}
+
+type MFRecordData struct {
+	nameRecordData
+}
+
+type MBRecordData struct {
+	nameRecordData
+}
+
+type MGRecordData struct {
+	nameRecordData
+}
+
+type MRRecordData struct {
+	nameRecordData
+}
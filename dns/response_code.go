@@ -1,6 +1,8 @@
 package dns
 
-type ResponseCode uint8
+// ResponseCode is the 12 bit extended response code. The lower four bits are
+// carried in the header and the rest in the OPT record (RFC 6891).
+type ResponseCode uint16
 
 const (
 	ResponseCodeNoError          ResponseCode = 0
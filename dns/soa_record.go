@@ -1,6 +1,9 @@
 package dns
 
-import "fmt"
+import (
+	"fmt"
+	"strconv"
+)
 
 type SOARecordData struct {
 	MName   Name
@@ -16,83 +19,99 @@ func (s SOARecordData) String() string {
 	return fmt.Sprintf("%s %s %d %d %d %d %d", s.MName, s.RName, s.Serial, s.Refresh, s.Retry, s.Expire, s.Minimum)
 }
 
-func (s SOARecordData) encode(w writeOffsetter, c *compressionCache) error {
-	buf := newOffsetWriter(w.Offset())
-	if err := s.MName.encode(buf, c); err != nil {
+func (s SOARecordData) EncodeRecordData(w *RecordDataWriter) error {
+	if err := w.WriteName(s.MName); err != nil {
 		return err
 	}
 
-	if err := s.RName.encode(buf, c); err != nil {
+	if err := w.WriteName(s.RName); err != nil {
 		return err
 	}
 
-	if err := writeUint32(buf, s.Serial); err != nil {
+	if err := w.WriteUint32(s.Serial); err != nil {
 		return err
 	}
 
-	if err := writeInt32(buf, s.Refresh); err != nil {
+	if err := w.WriteUint32(uint32(s.Refresh)); err != nil {
 		return err
 	}
 
-	if err := writeInt32(buf, s.Retry); err != nil {
+	if err := w.WriteUint32(uint32(s.Retry)); err != nil {
 		return err
 	}
 
-	if err := writeInt32(buf, s.Expire); err != nil {
+	if err := w.WriteUint32(uint32(s.Expire)); err != nil {
 		return err
 	}
 
-	if err := writeUint32(buf, s.Minimum); err != nil {
+	return w.WriteUint32(s.Minimum)
+}
+
+func (s *SOARecordData) DecodeRecordData(r *RecordDataReader) error {
+	var err error
+
+	if s.MName, err = r.ReadName(); err != nil {
 		return err
 	}
 
-	if err := writeUint32(w, buf.Len()); err != nil {
+	if s.RName, err = r.ReadName(); err != nil {
 		return err
 	}
 
-	_, err := buf.WriteTo(buf)
-	if err != nil {
+	if s.Serial, err = r.ReadUint32(); err != nil {
 		return err
 	}
 
-	return nil
-}
-
-func (s *SOARecordData) decode(r readSeekOffsetter) error {
-
-	// Discard RDLength as we know all the data
-	_, err := readUint32(r)
-	if err != nil {
+	var n uint32
+	if n, err = r.ReadUint32(); err != nil {
 		return err
 	}
+	s.Refresh = int32(n)
 
-	if err := s.MName.decode(r); err != nil {
+	if n, err = r.ReadUint32(); err != nil {
 		return err
 	}
+	s.Retry = int32(n)
 
-	if err := s.RName.decode(r); err != nil {
+	if n, err = r.ReadUint32(); err != nil {
 		return err
 	}
+	s.Expire = int32(n)
 
-	if s.Serial, err = readUint32(r); err != nil {
+	if s.Minimum, err = r.ReadUint32(); err != nil {
 		return err
 	}
 
-	if s.Refresh, err = readInt32(r); err != nil {
+	return nil
+}
+
+func (s *SOARecordData) ParseRecordData(fields []string, origin Name) error {
+	if err := checkFieldCount(fields, 7, TypeSOA); err != nil {
 		return err
 	}
 
-	if s.Retry, err = readInt32(r); err != nil {
+	var err error
+	if s.MName, err = ParseName(fields[0], origin); err != nil {
 		return err
 	}
-
-	if s.Expire, err = readInt32(r); err != nil {
+	if s.RName, err = ParseName(fields[1], origin); err != nil {
 		return err
 	}
 
-	if s.Minimum, err = readUint32(r); err != nil {
-		return err
+	serial, err := strconv.ParseUint(fields[2], 10, 32)
+	if err != nil {
+		return fmt.Errorf("invalid serial %q", fields[2])
+	}
+	s.Serial = uint32(serial)
+
+	times := make([]uint32, 4)
+	for i := range times {
+		if times[i], err = ParseTTL(fields[3+i]); err != nil {
+			return err
+		}
 	}
+	s.Refresh, s.Retry, s.Expire = int32(times[0]), int32(times[1]), int32(times[2])
+	s.Minimum = times[3]
 
 	return nil
 }
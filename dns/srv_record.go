@@ -0,0 +1,57 @@
+package dns
+
+import "fmt"
+
+// An SRV record locates the servers for a service (RFC 2782)
+type SRVRecordData struct {
+	Priority uint16
+	Weight   uint16
+	Port     uint16
+	Target   Name
+}
+
+func (s SRVRecordData) EncodeRecordData(w *RecordDataWriter) error {
+	for _, n := range []uint16{s.Priority, s.Weight, s.Port} {
+		if err := w.WriteUint16(n); err != nil {
+			return err
+		}
+	}
+	return w.WriteName(s.Target)
+}
+
+func (s *SRVRecordData) DecodeRecordData(r *RecordDataReader) error {
+	var err error
+	if s.Priority, err = r.ReadUint16(); err != nil {
+		return err
+	}
+	if s.Weight, err = r.ReadUint16(); err != nil {
+		return err
+	}
+	if s.Port, err = r.ReadUint16(); err != nil {
+		return err
+	}
+	s.Target, err = r.ReadName()
+	return err
+}
+
+func (s SRVRecordData) String() string {
+	return fmt.Sprintf("%d %d %d %s", s.Priority, s.Weight, s.Port, s.Target)
+}
+
+func (s *SRVRecordData) ParseRecordData(fields []string, origin Name) error {
+	if err := checkFieldCount(fields, 4, TypeSRV); err != nil {
+		return err
+	}
+	var err error
+	if s.Priority, err = parseUint16(fields[0]); err != nil {
+		return err
+	}
+	if s.Weight, err = parseUint16(fields[1]); err != nil {
+		return err
+	}
+	if s.Port, err = parseUint16(fields[2]); err != nil {
+		return err
+	}
+	s.Target, err = ParseName(fields[3], origin)
+	return err
+}
@@ -0,0 +1,57 @@
+package dns
+
+import (
+	"errors"
+	"strings"
+)
+
+// A TXT record
+type TXTRecordData struct {
+	Text []string
+}
+
+// EncodeRecordData writes the strings. Data without any is written as is,
+// so that records decoded with empty RDATA can be sent on.
+func (t TXTRecordData) EncodeRecordData(w *RecordDataWriter) error {
+	for _, s := range t.Text {
+		if err := w.WriteCharacterString(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *TXTRecordData) DecodeRecordData(r *RecordDataReader) error {
+	t.Text = []string{}
+	for r.Len() > 0 {
+		s, err := r.ReadCharacterString()
+		if err != nil {
+			return err
+		}
+		t.Text = append(t.Text, s)
+	}
+	return nil
+}
+
+func (t TXTRecordData) String() string {
+	quoted := make([]string, len(t.Text))
+	for i, s := range t.Text {
+		quoted[i] = quoteCharacterString(s)
+	}
+	return strings.Join(quoted, " ")
+}
+
+func (t *TXTRecordData) ParseRecordData(fields []string, origin Name) error {
+	if len(fields) == 0 {
+		return errors.New("TXT record needs at least one string")
+	}
+	t.Text = make([]string, len(fields))
+	for i, f := range fields {
+		s, err := parseCharacterString(f)
+		if err != nil {
+			return err
+		}
+		t.Text[i] = s
+	}
+	return nil
+}
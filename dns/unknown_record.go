@@ -0,0 +1,68 @@
+package dns
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+const unknownRecordDataPrefix = `\#`
+
+// UnknownRecordData is the RDATA of a record whose type is not supported. The
+// data is kept as it was received so it can be sent on unchanged (RFC 3597).
+type UnknownRecordData struct {
+	Data []byte
+}
+
+func (u *UnknownRecordData) EncodeRecordData(w *RecordDataWriter) error {
+	_, err := w.Write(u.Data)
+	return err
+}
+
+func (u *UnknownRecordData) DecodeRecordData(r *RecordDataReader) error {
+	var err error
+	if u.Data, err = r.ReadBytes(r.Len()); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// String returns the data in the generic format of RFC 3597 §5, \# followed
+// by the length of the data and the data in hex.
+func (u UnknownRecordData) String() string {
+	if len(u.Data) == 0 {
+		return fmt.Sprintf("%s 0", unknownRecordDataPrefix)
+	}
+	return fmt.Sprintf("%s %d %s", unknownRecordDataPrefix, len(u.Data), hex.EncodeToString(u.Data))
+}
+
+// ParseUnknownRecordData parses data in the generic format of RFC 3597 §5.
+// The hex data may be split into several words by white space.
+func ParseUnknownRecordData(s string) (*UnknownRecordData, error) {
+	return parseUnknownRecordData(strings.Fields(s))
+}
+
+func parseUnknownRecordData(fields []string) (*UnknownRecordData, error) {
+	if len(fields) < 2 || fields[0] != unknownRecordDataPrefix {
+		return nil, errors.New(`generic record data must start with \# and the data length`)
+	}
+
+	length, err := strconv.ParseUint(fields[1], 10, 16)
+	if err != nil {
+		return nil, fmt.Errorf("invalid record data length %q", fields[1])
+	}
+
+	data, err := hex.DecodeString(strings.Join(fields[2:], ""))
+	if err != nil {
+		return nil, fmt.Errorf("invalid record data: %w", err)
+	}
+
+	if len(data) != int(length) {
+		return nil, fmt.Errorf("record data is %d bytes but length is %d", len(data), length)
+	}
+
+	return &UnknownRecordData{Data: data}, nil
+}
@@ -0,0 +1,115 @@
+package dns
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+)
+
+const (
+	protocolTCP uint8 = 6
+	protocolUDP uint8 = 17
+)
+
+// A WKS record
+type WKSRecordData struct {
+	Address  net.IP
+	Protocol uint8
+	// A bit map with one bit per port of the protocol. The first bit
+	// corresponds to port 0.
+	BitMap []byte
+}
+
+func (wks WKSRecordData) EncodeRecordData(w *RecordDataWriter) error {
+	addr := wks.Address.To4()
+	if addr == nil {
+		return errors.New("invalid wks record")
+	}
+	if _, err := w.Write(addr); err != nil {
+		return err
+	}
+	if err := w.WriteUint8(wks.Protocol); err != nil {
+		return err
+	}
+	_, err := w.Write(wks.BitMap)
+	return err
+}
+
+func (wks *WKSRecordData) DecodeRecordData(r *RecordDataReader) error {
+	if r.Len() < net.IPv4len+1 {
+		return errors.New("invalid wks record")
+	}
+
+	addr, err := r.ReadBytes(net.IPv4len)
+	if err != nil {
+		return err
+	}
+	wks.Address = net.IP(addr)
+
+	if wks.Protocol, err = r.ReadUint8(); err != nil {
+		return err
+	}
+
+	wks.BitMap, err = r.ReadBytes(r.Len())
+	return err
+}
+
+// Ports returns the ports set in the bit map.
+func (wks WKSRecordData) Ports() []int {
+	ports := []int{}
+	for i, b := range wks.BitMap {
+		for bit := 0; bit < 8; bit++ {
+			if b&(0x80>>bit) != 0 {
+				ports = append(ports, i*8+bit)
+			}
+		}
+	}
+	return ports
+}
+
+func (wks WKSRecordData) String() string {
+	s := []string{wks.Address.String(), fmt.Sprint(wks.Protocol)}
+	for _, p := range wks.Ports() {
+		s = append(s, fmt.Sprint(p))
+	}
+	return strings.Join(s, " ")
+}
+
+func (wks *WKSRecordData) ParseRecordData(fields []string, origin Name) error {
+	if len(fields) < 2 {
+		return errors.New("WKS record needs an address and a protocol")
+	}
+
+	wks.Address = net.ParseIP(fields[0]).To4()
+	if wks.Address == nil {
+		return fmt.Errorf("invalid ipv4 address %q", fields[0])
+	}
+
+	switch strings.ToLower(fields[1]) {
+	case "tcp":
+		wks.Protocol = protocolTCP
+	case "udp":
+		wks.Protocol = protocolUDP
+	default:
+		p, err := strconv.ParseUint(fields[1], 10, 8)
+		if err != nil {
+			return fmt.Errorf("invalid protocol %q", fields[1])
+		}
+		wks.Protocol = uint8(p)
+	}
+
+	wks.BitMap = []byte{}
+	for _, f := range fields[2:] {
+		port, err := parseUint16(f)
+		if err != nil {
+			return err
+		}
+		for int(port)/8 >= len(wks.BitMap) {
+			wks.BitMap = append(wks.BitMap, 0)
+		}
+		wks.BitMap[port/8] |= 0x80 >> (port % 8)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package zonefile
+
+import (
+	"errors"
+)
+
+type tokenKind int
+
+const (
+	tokenWord tokenKind = iota
+	tokenNewline
+	tokenEOF
+)
+
+type token struct {
+	kind   tokenKind
+	value  string
+	quoted bool
+	line   int
+	column int
+}
+
+// lexer splits a master file into words. Comments are dropped and newlines
+// inside parentheses are ignored so that a record spread over several lines
+// reads as one entry. Escape sequences are left in words for the record data
+// parsers to decode.
+type lexer struct {
+	data   []byte
+	pos    int
+	line   int
+	column int
+	parens int
+
+	// position of the outermost open parenthesis
+	parenLine   int
+	parenColumn int
+}
+
+func newLexer(data []byte) *lexer {
+	return &lexer{
+		data:   data,
+		line:   1,
+		column: 1,
+	}
+}
+
+func (l *lexer) next() (token, error) {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		switch c {
+		case ' ', '\t', '\r':
+			l.advance()
+		case ';':
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' {
+				l.advance()
+			}
+		case '\n':
+			tok := token{kind: tokenNewline, line: l.line, column: l.column}
+			l.advance()
+			if l.parens == 0 {
+				return tok, nil
+			}
+		case '(':
+			if l.parens == 0 {
+				l.parenLine, l.parenColumn = l.line, l.column
+			}
+			l.parens++
+			l.advance()
+		case ')':
+			if l.parens == 0 {
+				return token{}, l.errorf(l.line, l.column, errors.New("unbalanced closing parenthesis"))
+			}
+			l.parens--
+			l.advance()
+		case '"':
+			return l.quoted()
+		default:
+			return l.word()
+		}
+	}
+
+	if l.parens > 0 {
+		return token{}, l.errorf(l.parenLine, l.parenColumn, errors.New("unclosed parenthesis"))
+	}
+	return token{kind: tokenEOF, line: l.line, column: l.column}, nil
+}
+
+func (l *lexer) word() (token, error) {
+	tok := token{kind: tokenWord, line: l.line, column: l.column}
+	start := l.pos
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if c == '\\' {
+			l.advance()
+			if l.pos == len(l.data) || l.data[l.pos] == '\n' {
+				return token{}, l.errorf(tok.line, tok.column, errors.New("escape at end of line"))
+			}
+			l.advance()
+			continue
+		}
+		if isDelimiter(c) {
+			break
+		}
+		l.advance()
+	}
+	tok.value = string(l.data[start:l.pos])
+	return tok, nil
+}
+
+func (l *lexer) quoted() (token, error) {
+	tok := token{kind: tokenWord, quoted: true, line: l.line, column: l.column}
+	l.advance()
+	start := l.pos
+	for {
+		if l.pos == len(l.data) || l.data[l.pos] == '\n' {
+			return token{}, l.errorf(tok.line, tok.column, errors.New("unterminated quoted string"))
+		}
+		c := l.data[l.pos]
+		if c == '"' {
+			break
+		}
+		if c == '\\' {
+			l.advance()
+			if l.pos == len(l.data) {
+				continue
+			}
+		}
+		l.advance()
+	}
+	tok.value = string(l.data[start:l.pos])
+	l.advance()
+	return tok, nil
+}
+
+func (l *lexer) advance() {
+	if l.data[l.pos] == '\n' {
+		l.line++
+		l.column = 1
+	} else {
+		l.column++
+	}
+	l.pos++
+}
+
+func (l *lexer) errorf(line, column int, err error) error {
+	return &Error{Line: line, Column: column, Err: err}
+}
+
+func isDelimiter(c byte) bool {
+	switch c {
+	case ' ', '\t', '\r', '\n', ';', '(', ')', '"':
+		return true
+	}
+	return false
+}
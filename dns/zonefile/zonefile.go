@@ -0,0 +1,352 @@
+// Package zonefile reads master files in the text format described in
+// RFC 1035 §5, with the $TTL directive of RFC 2308 §4.
+package zonefile
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/davidseybold/dns-resolver/dns"
+)
+
+// maxIncludeDepth bounds how deeply $INCLUDE directives can be nested, which
+// also stops files that include themselves.
+const maxIncludeDepth = 16
+
+// Error is an error found in a master file, along with where it was found.
+type Error struct {
+	// File is empty when parsing from a reader.
+	File   string
+	Line   int
+	Column int
+	Err    error
+}
+
+func (e *Error) Error() string {
+	if e.File == "" {
+		return fmt.Sprintf("line %d, column %d: %v", e.Line, e.Column, e.Err)
+	}
+	return fmt.Sprintf("%s:%d:%d: %v", e.File, e.Line, e.Column, e.Err)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Parse reads the records of a master file. Relative names are relative to
+// origin until a $ORIGIN directive changes it; origin may be nil if the file
+// only uses absolute names or sets its own. Files named by $INCLUDE are
+// opened relative to the working directory.
+func Parse(r io.Reader, origin dns.Name) ([]dns.ResourceRecord, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	p := newParser("", data, origin)
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.records, nil
+}
+
+// ParseFile reads the records of the master file at path. Files named by
+// $INCLUDE are opened relative to the directory of the including file.
+func ParseFile(path string, origin dns.Name) ([]dns.ResourceRecord, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	p := newParser(path, data, origin)
+	if err := p.parse(); err != nil {
+		return nil, err
+	}
+	return p.records, nil
+}
+
+// ParseRR parses a single record in master file syntax, such as one written by
+// dns.ResourceRecord.String. The record must have an owner name and a TTL.
+func ParseRR(s string, origin dns.Name) (dns.ResourceRecord, error) {
+	p := newParser("", []byte(s), origin)
+	entry, err := p.entry()
+	if err != nil {
+		return dns.ResourceRecord{}, err
+	}
+	if entry == nil {
+		return dns.ResourceRecord{}, errors.New("no record found")
+	}
+	if first := entry[0]; first.column != 1 || strings.HasPrefix(first.value, "$") {
+		return dns.ResourceRecord{}, errorAt(first, errors.New("expected an owner name"))
+	}
+	if err := p.handle(entry); err != nil {
+		return dns.ResourceRecord{}, err
+	}
+
+	rest, err := p.entry()
+	if err != nil {
+		return dns.ResourceRecord{}, err
+	}
+	if rest != nil {
+		return dns.ResourceRecord{}, errorAt(rest[0], errors.New("more than one record"))
+	}
+	return p.records[0], nil
+}
+
+type parser struct {
+	lex   *lexer
+	file  string
+	depth int
+
+	origin dns.Name
+	// owner is the owner of the previous record, used when an entry starts
+	// with whitespace.
+	owner dns.Name
+	class dns.Class
+
+	// defaultTTL is set by $TTL. Without it, records that leave out their
+	// TTL use the last one given explicitly (RFC 1035 §5.1).
+	defaultTTL    uint32
+	hasDefaultTTL bool
+	lastTTL       uint32
+	hasLastTTL    bool
+
+	records []dns.ResourceRecord
+}
+
+func newParser(file string, data []byte, origin dns.Name) *parser {
+	return &parser{
+		lex:    newLexer(data),
+		file:   file,
+		origin: origin,
+		class:  dns.ClassIN,
+	}
+}
+
+func (p *parser) parse() error {
+	for {
+		entry, err := p.entry()
+		if err != nil {
+			return p.wrap(err)
+		}
+		if entry == nil {
+			return nil
+		}
+		if err := p.handle(entry); err != nil {
+			return p.wrap(err)
+		}
+	}
+}
+
+// entry returns the words of the next non-empty entry, or nil at the end of
+// the file.
+func (p *parser) entry() ([]token, error) {
+	var entry []token
+	for {
+		tok, err := p.lex.next()
+		if err != nil {
+			return nil, err
+		}
+		switch tok.kind {
+		case tokenWord:
+			entry = append(entry, tok)
+		case tokenNewline:
+			if len(entry) > 0 {
+				return entry, nil
+			}
+		case tokenEOF:
+			return entry, nil
+		}
+	}
+}
+
+func (p *parser) handle(entry []token) error {
+	first := entry[0]
+	if first.column == 1 && !first.quoted && strings.HasPrefix(first.value, "$") {
+		return p.directive(entry)
+	}
+
+	// An entry starting with whitespace belongs to the previous owner.
+	if first.column != 1 {
+		if p.owner == nil {
+			return errorAt(first, errors.New("no previous owner name"))
+		}
+		return p.record(p.owner, first, entry)
+	}
+
+	owner, err := dns.ParseName(first.value, p.origin)
+	if err != nil {
+		return errorAt(first, err)
+	}
+	p.owner = owner
+	return p.record(owner, first, entry[1:])
+}
+
+func (p *parser) directive(entry []token) error {
+	name, args := entry[0], entry[1:]
+	switch strings.ToUpper(name.value) {
+	case "$ORIGIN":
+		if len(args) != 1 {
+			return errorAt(name, errors.New("$ORIGIN needs a single domain name"))
+		}
+		origin, err := dns.ParseName(args[0].value, p.origin)
+		if err != nil {
+			return errorAt(args[0], err)
+		}
+		p.origin = origin
+	case "$TTL":
+		if len(args) != 1 {
+			return errorAt(name, errors.New("$TTL needs a single ttl"))
+		}
+		ttl, err := dns.ParseTTL(args[0].value)
+		if err != nil {
+			return errorAt(args[0], err)
+		}
+		p.defaultTTL, p.hasDefaultTTL = ttl, true
+	case "$INCLUDE":
+		if len(args) != 1 && len(args) != 2 {
+			return errorAt(name, errors.New("$INCLUDE needs a file name and optionally an origin"))
+		}
+		return p.include(args)
+	default:
+		return errorAt(name, fmt.Errorf("unknown directive %s", name.value))
+	}
+	return nil
+}
+
+// include parses the records of an included file. The origin is restored
+// afterwards, as required by RFC 1035 §5.1.
+func (p *parser) include(args []token) error {
+	if p.depth >= maxIncludeDepth {
+		return errorAt(args[0], errors.New("$INCLUDE nested too deeply"))
+	}
+
+	path := args[0].value
+	if !filepath.IsAbs(path) && p.file != "" {
+		path = filepath.Join(filepath.Dir(p.file), path)
+	}
+
+	origin := p.origin
+	if len(args) == 2 {
+		var err error
+		origin, err = dns.ParseName(args[1].value, p.origin)
+		if err != nil {
+			return errorAt(args[1], err)
+		}
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return errorAt(args[0], err)
+	}
+
+	child := newParser(path, data, origin)
+	child.depth = p.depth + 1
+	child.class = p.class
+	child.defaultTTL, child.hasDefaultTTL = p.defaultTTL, p.hasDefaultTTL
+	child.lastTTL, child.hasLastTTL = p.lastTTL, p.hasLastTTL
+	if err := child.parse(); err != nil {
+		return err
+	}
+	p.records = append(p.records, child.records...)
+	return nil
+}
+
+// record parses the rest of a record entry after its owner name:
+//
+//	[<TTL>] [<class>] <type> <RDATA>
+//
+// where the TTL and class may appear in either order. first is the first
+// token of the entry.
+func (p *parser) record(owner dns.Name, first token, fields []token) error {
+	rr := dns.ResourceRecord{Name: owner}
+	last := first
+	if len(fields) > 0 {
+		last = fields[len(fields)-1]
+	}
+
+	var hasTTL, hasClass bool
+	for len(fields) > 0 {
+		if !hasTTL {
+			if ttl, err := dns.ParseTTL(fields[0].value); err == nil {
+				rr.TTL, hasTTL = ttl, true
+				fields = fields[1:]
+				continue
+			}
+		}
+		if !hasClass {
+			if class, err := dns.ParseClass(fields[0].value); err == nil {
+				rr.Class, hasClass = class, true
+				fields = fields[1:]
+				continue
+			}
+		}
+		break
+	}
+
+	if len(fields) == 0 {
+		return errorAt(last, errors.New("missing record type"))
+	}
+	typeTok := fields[0]
+	t, err := dns.ParseType(typeTok.value)
+	if err != nil {
+		return errorAt(typeTok, err)
+	}
+	if t == dns.TypeOPT || (t >= 128 && t <= 255) {
+		return errorAt(typeTok, fmt.Errorf("type %s cannot appear in a master file", t))
+	}
+	rr.Type = t
+
+	switch {
+	case hasTTL:
+		p.lastTTL, p.hasLastTTL = rr.TTL, true
+	case p.hasDefaultTTL:
+		rr.TTL = p.defaultTTL
+	case p.hasLastTTL:
+		rr.TTL = p.lastTTL
+	default:
+		return errorAt(typeTok, errors.New("no ttl given and no $TTL set"))
+	}
+
+	if hasClass {
+		p.class = rr.Class
+	} else {
+		rr.Class = p.class
+	}
+
+	rdata := fields[1:]
+	values := make([]string, len(rdata))
+	for i, tok := range rdata {
+		values[i] = tok.value
+	}
+	// Only an unquoted \# starts the generic format (RFC 3597 §5).
+	if len(rdata) > 0 && rdata[0].quoted {
+		rr.Data, err = dns.ParseTypeRecordData(t, values, p.origin)
+	} else {
+		rr.Data, err = dns.ParseRecordData(t, values, p.origin)
+	}
+	if err != nil {
+		if len(rdata) > 0 {
+			return errorAt(rdata[0], err)
+		}
+		return errorAt(typeTok, err)
+	}
+
+	p.records = append(p.records, rr)
+	return nil
+}
+
+// wrap sets the file of errors found in this parser's file.
+func (p *parser) wrap(err error) error {
+	var e *Error
+	if errors.As(err, &e) && e.File == "" {
+		e.File = p.file
+	}
+	return err
+}
+
+func errorAt(tok token, err error) error {
+	return &Error{Line: tok.line, Column: tok.column, Err: err}
+}
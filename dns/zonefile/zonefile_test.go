@@ -0,0 +1,149 @@
+package zonefile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/davidseybold/dns-resolver/dns"
+)
+
+func TestParseFile(t *testing.T) {
+	tests := []struct {
+		name string
+		// files are written to a temporary directory and the one named
+		// "zone" is parsed.
+		files   map[string]string
+		origin  dns.Name
+		want    []string
+		wantErr bool
+	}{
+		{
+			name:   "relative names use the origin",
+			files:  map[string]string{"zone": "www 60 IN A 192.0.2.1\n@ 60 IN A 192.0.2.2\n"},
+			origin: dns.NewName("example."),
+			want: []string{
+				"www.example.\t60\tIN\tA\t192.0.2.1",
+				"example.\t60\tIN\tA\t192.0.2.2",
+			},
+		},
+		{
+			name:  "$ORIGIN changes the origin",
+			files: map[string]string{"zone": "$ORIGIN example.\nwww 60 IN A 192.0.2.1\n$ORIGIN sub.example.\nwww 60 IN A 192.0.2.2\n"},
+			want: []string{
+				"www.example.\t60\tIN\tA\t192.0.2.1",
+				"www.sub.example.\t60\tIN\tA\t192.0.2.2",
+			},
+		},
+		{
+			name:    "relative name without an origin",
+			files:   map[string]string{"zone": "www 60 IN A 192.0.2.1\n"},
+			wantErr: true,
+		},
+		{
+			name:  "$TTL is the default ttl",
+			files: map[string]string{"zone": "$TTL 1h\nexample. IN A 192.0.2.1\nexample. 60 IN A 192.0.2.2\nexample. IN A 192.0.2.3\n"},
+			want: []string{
+				"example.\t3600\tIN\tA\t192.0.2.1",
+				"example.\t60\tIN\tA\t192.0.2.2",
+				"example.\t3600\tIN\tA\t192.0.2.3",
+			},
+		},
+		{
+			name:  "without $TTL the last ttl is used",
+			files: map[string]string{"zone": "example. 60 IN A 192.0.2.1\nexample. IN A 192.0.2.2\n"},
+			want: []string{
+				"example.\t60\tIN\tA\t192.0.2.1",
+				"example.\t60\tIN\tA\t192.0.2.2",
+			},
+		},
+		{
+			name:    "invalid $TTL",
+			files:   map[string]string{"zone": "$TTL forever\n"},
+			wantErr: true,
+		},
+		{
+			name: "$INCLUDE is relative to the including file",
+			files: map[string]string{
+				"zone":     "$ORIGIN example.\n$INCLUDE included\nwww 60 IN A 192.0.2.2\n",
+				"included": "ftp 60 IN A 192.0.2.1\n",
+			},
+			want: []string{
+				"ftp.example.\t60\tIN\tA\t192.0.2.1",
+				"www.example.\t60\tIN\tA\t192.0.2.2",
+			},
+		},
+		{
+			name: "$INCLUDE with an origin does not change the including file's",
+			files: map[string]string{
+				"zone":     "$ORIGIN example.\n$INCLUDE included sub.example.\nwww 60 IN A 192.0.2.2\n",
+				"included": "www 60 IN A 192.0.2.1\n",
+			},
+			want: []string{
+				"www.sub.example.\t60\tIN\tA\t192.0.2.1",
+				"www.example.\t60\tIN\tA\t192.0.2.2",
+			},
+		},
+		{
+			name:    "$INCLUDE of itself",
+			files:   map[string]string{"zone": "$INCLUDE zone\n"},
+			wantErr: true,
+		},
+		{
+			name:    "$INCLUDE of a missing file",
+			files:   map[string]string{"zone": "$INCLUDE missing\n"},
+			wantErr: true,
+		},
+		{
+			name:  "generic rdata of a known type",
+			files: map[string]string{"zone": "example. 60 IN A \\# 4 C0000201\n"},
+			want:  []string{"example.\t60\tIN\tA\t192.0.2.1"},
+		},
+		{
+			name:  "generic rdata of an unknown type",
+			files: map[string]string{"zone": "example. 60 IN TYPE65000 \\# 2 abcd\n"},
+			want:  []string{"example.\t60\tIN\tTYPE65000\t\\# 2 abcd"},
+		},
+		{
+			name:  "quoted \\# is not generic rdata",
+			files: map[string]string{"zone": "example. 60 IN TXT \"\\#\" 0\n"},
+			want:  []string{"example.\t60\tIN\tTXT\t\"#\" \"0\""},
+		},
+		{
+			name:    "generic rdata with the wrong length",
+			files:   map[string]string{"zone": "example. 60 IN A \\# 3 C0000201\n"},
+			wantErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			for name, data := range tt.files {
+				if err := os.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			records, err := ParseFile(filepath.Join(dir, "zone"), tt.origin)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("ParseFile() = %v, want an error", records)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("ParseFile() error = %v", err)
+			}
+
+			got := make([]string, len(records))
+			for i, rr := range records {
+				got[i] = rr.String()
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseFile() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,4 +2,4 @@ module github.com/davidseybold/dns-resolver
 
 go 1.17
 
-require github.com/mitchellh/hashstructure/v2 v2.0.2
+require github.com/BurntSushi/toml v1.2.1
@@ -0,0 +1,129 @@
+package network
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/davidseybold/dns-resolver/dns"
+	"github.com/davidseybold/dns-resolver/resolver"
+)
+
+const (
+	opcodeQuery byte  = 0
+	ednsVersion uint8 = 0
+)
+
+// HandleMessage decodes a raw message received from a client and builds the
+// response to it. It returns false if the message is not a query and should
+// be dropped.
+func HandleMessage(r *resolver.Resolver, raw []byte) (dns.Packet, bool) {
+	query, err := dns.DecodePacket(raw)
+	if err != nil {
+		return FormatError(raw), true
+	}
+	if query.Type {
+		return dns.Packet{}, false
+	}
+	return HandleQuery(r, query), true
+}
+
+// HandleQuery resolves each question in the query and builds the response to
+// send back to the client.
+func HandleQuery(r *resolver.Resolver, query dns.Packet) dns.Packet {
+	resp := newResponse(query)
+
+	if query.OPT != nil {
+		resp.OPT = &dns.OPT{
+			UDPPayloadSize: udpPayloadSize(query.OPT),
+			DNSSECOK:       query.OPT.DNSSECOK,
+		}
+		if query.OPT.Version != ednsVersion {
+			resp.ResponseCode = dns.ResponseCodeBadOptVersion
+			return resp
+		}
+	}
+
+	if query.Opcode != opcodeQuery {
+		resp.ResponseCode = dns.ResponseCodeNotImplemented
+		return resp
+	}
+
+	if len(query.Questions) == 0 {
+		resp.ResponseCode = dns.ReponseCodeFormError
+		return resp
+	}
+
+	for _, q := range query.Questions {
+		records, err := r.Lookup(q.Name, q.Class, q.Type)
+		resp.Answers = append(resp.Answers, records...)
+
+		var neg *resolver.NegativeError
+		if errors.As(err, &neg) {
+			resp.Answers = append(resp.Answers, neg.Answers...)
+			if neg.SOA != nil {
+				resp.Authorities = append(resp.Authorities, *neg.SOA)
+			}
+		}
+		if rcode := responseCode(err); rcode != dns.ResponseCodeNoError {
+			resp.ResponseCode = rcode
+			break
+		}
+	}
+
+	return resp
+}
+
+// FormatError builds the response to a query that could not be decoded. The
+// ID is taken from the raw query if it is long enough to contain one.
+func FormatError(raw []byte) dns.Packet {
+	resp := dns.Packet{}
+	if len(raw) >= 2 {
+		resp.ID = binary.BigEndian.Uint16(raw)
+	}
+	resp.Type = true
+	resp.Flags.RecursionAvailable = true
+	resp.ResponseCode = dns.ReponseCodeFormError
+	return resp
+}
+
+func newResponse(query dns.Packet) dns.Packet {
+	resp := dns.Packet{
+		Questions: query.Questions,
+	}
+	resp.ID = query.ID
+	resp.Type = true
+	resp.Opcode = query.Opcode
+	resp.Flags.RecursionDesired = query.Flags.RecursionDesired
+	resp.Flags.RecursionAvailable = true
+	resp.Flags.CheckingDisabled = query.Flags.CheckingDisabled
+	return resp
+}
+
+// udpPayloadSize is the size responses to the client are limited to, which is
+// the smaller of what the client and the server can handle.
+func udpPayloadSize(opt *dns.OPT) uint16 {
+	if opt.UDPPayloadSize > dns.DefaultUDPPayloadSize {
+		return dns.DefaultUDPPayloadSize
+	}
+	return opt.UDPPayloadSize
+}
+
+func responseCode(err error) dns.ResponseCode {
+	if err == nil {
+		return dns.ResponseCodeNoError
+	}
+
+	var dnsErr dns.Error
+	if !errors.As(err, &dnsErr) {
+		return dns.ResponseCodeServerFailure
+	}
+
+	switch dnsErr {
+	case dns.NewNameError():
+		return dns.ResponseCodeNXDomain
+	case dns.NewDataNotFoundError():
+		return dns.ResponseCodeNoError
+	default:
+		return dns.ResponseCodeServerFailure
+	}
+}
@@ -1 +1,350 @@
 package tcp
+
+import (
+	"context"
+	"encoding/binary"
+	"errors"
+	"io"
+	"log"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/davidseybold/dns-resolver/dns"
+	"github.com/davidseybold/dns-resolver/network"
+	"github.com/davidseybold/dns-resolver/resolver"
+)
+
+const (
+	defaultIdleTimeout    = 10 * time.Second
+	defaultWriteTimeout   = 10 * time.Second
+	defaultMaxConnections = 128
+	defaultMaxPipelined   = 32
+)
+
+// TCPServer answers DNS queries over TCP as described in RFC 7766. Queries
+// pipelined on a connection are resolved concurrently and their responses
+// are sent as soon as they are ready, which may be out of order.
+type TCPServer struct {
+	addr           string
+	idleTimeout    time.Duration
+	writeTimeout   time.Duration
+	maxConnections int
+	maxPipelined   int
+	logger         *log.Logger
+
+	mu       sync.Mutex
+	r        *resolver.Resolver
+	listener net.Listener
+	conns    map[net.Conn]struct{}
+	closing  bool
+	// serving tracks the connections being served so shutdown can wait for
+	// them.
+	serving sync.WaitGroup
+}
+
+// Option configures a TCPServer.
+type Option func(*TCPServer)
+
+// WithIdleTimeout sets how long a connection may wait for its next query
+// before it is closed.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(t *TCPServer) {
+		t.idleTimeout = d
+	}
+}
+
+// WithWriteTimeout sets how long writing a response may take before the
+// connection is closed, so that clients which stop reading cannot hold on to
+// it.
+func WithWriteTimeout(d time.Duration) Option {
+	return func(t *TCPServer) {
+		t.writeTimeout = d
+	}
+}
+
+// WithMaxPipelined sets the number of queries on a connection that may be
+// resolved at once. While that many are outstanding no more are read from
+// the connection. n must be positive.
+func WithMaxPipelined(n int) Option {
+	return func(t *TCPServer) {
+		t.maxPipelined = n
+	}
+}
+
+// WithMaxConnections sets the number of connections that may be open at
+// once. Connections accepted beyond the limit are closed immediately.
+func WithMaxConnections(n int) Option {
+	return func(t *TCPServer) {
+		t.maxConnections = n
+	}
+}
+
+// WithErrorLog sets the logger errors are written to.
+func WithErrorLog(l *log.Logger) Option {
+	return func(t *TCPServer) {
+		t.logger = l
+	}
+}
+
+// NewTCPServer creates a server that answers queries received on addr using
+// the resolver.
+func NewTCPServer(addr string, r *resolver.Resolver, opts ...Option) *TCPServer {
+	t := &TCPServer{
+		r:              r,
+		addr:           addr,
+		idleTimeout:    defaultIdleTimeout,
+		writeTimeout:   defaultWriteTimeout,
+		maxConnections: defaultMaxConnections,
+		maxPipelined:   defaultMaxPipelined,
+		logger:         log.Default(),
+		conns:          make(map[net.Conn]struct{}),
+	}
+	for _, opt := range opts {
+		opt(t)
+	}
+	return t
+}
+
+// Listen accepts connections on the server's address until the server is
+// closed.
+func (t *TCPServer) Listen() error {
+	l, err := net.Listen("tcp", t.addr)
+	if err != nil {
+		return err
+	}
+	return t.Serve(l)
+}
+
+// Serve accepts connections from l until the server is closed.
+func (t *TCPServer) Serve(l net.Listener) error {
+	t.mu.Lock()
+	if t.closing {
+		t.mu.Unlock()
+		return l.Close()
+	}
+	t.listener = l
+	t.mu.Unlock()
+
+	for {
+		conn, err := l.Accept()
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			t.logger.Println("error occurred", err)
+			continue
+		}
+
+		if !t.track(conn) {
+			conn.Close()
+			continue
+		}
+
+		go func() {
+			defer t.untrack(conn)
+			t.serve(conn)
+		}()
+	}
+}
+
+// Close stops accepting connections and closes any that are open.
+func (t *TCPServer) Close() error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	t.closing = true
+	for conn := range t.conns {
+		conn.Close()
+	}
+	if t.listener == nil {
+		return nil
+	}
+	return t.listener.Close()
+}
+
+// Shutdown stops accepting connections and reading queries, then waits for
+// the responses to the queries already read to be sent before closing the
+// connections. If ctx is done first the remaining connections are closed
+// without waiting any longer.
+func (t *TCPServer) Shutdown(ctx context.Context) error {
+	t.mu.Lock()
+	t.closing = true
+	var err error
+	if t.listener != nil {
+		err = t.listener.Close()
+	}
+	// Wake up connections waiting for their next query.
+	for conn := range t.conns {
+		conn.SetReadDeadline(time.Now())
+	}
+	t.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		t.serving.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+		t.Close()
+		return ctx.Err()
+	}
+}
+
+// SetResolver changes the resolver that answers the queries read from now
+// on.
+func (t *TCPServer) SetResolver(r *resolver.Resolver) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.r = r
+}
+
+func (t *TCPServer) resolver() *resolver.Resolver {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return t.r
+}
+
+func (t *TCPServer) track(conn net.Conn) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closing || len(t.conns) >= t.maxConnections {
+		return false
+	}
+	t.conns[conn] = struct{}{}
+	t.serving.Add(1)
+	return true
+}
+
+func (t *TCPServer) untrack(conn net.Conn) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	delete(t.conns, conn)
+	conn.Close()
+	t.serving.Done()
+}
+
+// setReadDeadline starts the idle timer for the connection if idle is set,
+// and stops it otherwise. It returns false once the server is shutting down,
+// leaving the deadline set by Shutdown in place.
+func (t *TCPServer) setReadDeadline(conn net.Conn, idle bool) bool {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.closing {
+		return false
+	}
+	var deadline time.Time
+	if idle {
+		deadline = time.Now().Add(t.idleTimeout)
+	}
+	return conn.SetReadDeadline(deadline) == nil
+}
+
+// serve reads queries from the connection until it is idle for too long or
+// the client closes it, then waits for any outstanding responses. The
+// connection only counts as idle while no queries are outstanding (RFC 7766
+// §6.2.3).
+func (t *TCPServer) serve(conn net.Conn) {
+	var (
+		wg      sync.WaitGroup
+		writeMu sync.Mutex
+		// outstanding counts the queries not yet answered, guarded by
+		// idleMu.
+		outstanding int
+		idleMu      sync.Mutex
+		// pipelined holds a slot for each query being resolved.
+		pipelined = make(chan struct{}, t.maxPipelined)
+	)
+	defer wg.Wait()
+
+	if !t.setReadDeadline(conn, true) {
+		return
+	}
+	for {
+		// Stop reading until a slot is free. The write timeout ensures one
+		// becomes free even if the client does not read the responses.
+		pipelined <- struct{}{}
+		msg, err := readMessage(conn)
+		if err != nil {
+			return
+		}
+
+		idleMu.Lock()
+		outstanding++
+		if outstanding == 1 {
+			t.setReadDeadline(conn, false)
+		}
+		idleMu.Unlock()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer func() { <-pipelined }()
+			defer func() {
+				idleMu.Lock()
+				defer idleMu.Unlock()
+				outstanding--
+				if outstanding == 0 {
+					t.setReadDeadline(conn, true)
+				}
+			}()
+
+			res := t.handleRequest(msg)
+			if res == nil {
+				return
+			}
+
+			writeMu.Lock()
+			defer writeMu.Unlock()
+			conn.SetWriteDeadline(time.Now().Add(t.writeTimeout))
+			if err := writeMessage(conn, res); err != nil {
+				// The response may have been partly written, so nothing
+				// more can be sent on the connection.
+				t.logger.Println("error occurred", err)
+				conn.Close()
+			}
+		}()
+	}
+}
+
+func (t *TCPServer) handleRequest(buffer []byte) []byte {
+	resp, ok := network.HandleMessage(t.resolver(), buffer)
+	if !ok {
+		return nil
+	}
+
+	res, err := dns.EncodeTCPPacket(resp)
+	if err != nil {
+		t.logger.Println("error occurred", err)
+		return nil
+	}
+
+	return res.Bytes
+}
+
+// readMessage reads a message prefixed with its two byte length.
+func readMessage(r io.Reader) ([]byte, error) {
+	var l uint16
+	if err := binary.Read(r, binary.BigEndian, &l); err != nil {
+		return nil, err
+	}
+	msg := make([]byte, l)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return nil, err
+	}
+	return msg, nil
+}
+
+// writeMessage writes the message prefixed with its two byte length in a
+// single write.
+func writeMessage(w io.Writer, msg []byte) error {
+	buf := make([]byte, 2+len(msg))
+	binary.BigEndian.PutUint16(buf, uint16(len(msg)))
+	copy(buf[2:], msg)
+	_, err := w.Write(buf)
+	return err
+}
@@ -1,19 +1,60 @@
 package udp
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"log"
 	"net"
+	"sync"
+	"time"
 
+	"github.com/davidseybold/dns-resolver/dns"
+	"github.com/davidseybold/dns-resolver/network"
 	"github.com/davidseybold/dns-resolver/resolver"
 )
 
+const maxQuerySize = 65535
+
 type UDPServer struct {
-	r *resolver.Resolver
+	addr   string
+	logger *log.Logger
+
+	mu      sync.Mutex
+	r       *resolver.Resolver
+	conn    *net.UDPConn
+	closing bool
+	// queries tracks the queries being handled so shutdown can wait for them.
+	queries sync.WaitGroup
 }
 
-func (u *UDPServer) Listen() error {
+// Option configures a UDPServer.
+type Option func(*UDPServer)
+
+// WithErrorLog sets the logger errors are written to.
+func WithErrorLog(l *log.Logger) Option {
+	return func(u *UDPServer) {
+		u.logger = l
+	}
+}
 
-	sAddr, err := net.ResolveUDPAddr("udp4", ":53")
+// NewUDPServer creates a server that answers queries received on addr using
+// the resolver.
+func NewUDPServer(addr string, r *resolver.Resolver, opts ...Option) *UDPServer {
+	u := &UDPServer{
+		r:      r,
+		addr:   addr,
+		logger: log.Default(),
+	}
+	for _, opt := range opts {
+		opt(u)
+	}
+	return u
+}
+
+// Listen receives queries on the server's address until the server is
+// closed.
+func (u *UDPServer) Listen() error {
+	sAddr, err := net.ResolveUDPAddr("udp", u.addr)
 	if err != nil {
 		return err
 	}
@@ -21,22 +62,138 @@ func (u *UDPServer) Listen() error {
 	if err != nil {
 		return err
 	}
+	return u.Serve(conn)
+}
+
+// Serve receives queries on conn until the server is closed. Each query is
+// handled in its own goroutine.
+func (u *UDPServer) Serve(conn *net.UDPConn) error {
+	u.mu.Lock()
+	if u.closing {
+		u.mu.Unlock()
+		return conn.Close()
+	}
+	u.conn = conn
+	u.mu.Unlock()
 
-	buffer := make([]byte, 1024)
+	buffer := make([]byte, maxQuerySize)
 
 	for {
 		n, cAddr, err := conn.ReadFromUDP(buffer)
+		if errors.Is(err, net.ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			if u.isClosing() {
+				return nil
+			}
+			u.logger.Println("error occurred", err)
+			continue
+		}
 
-		res := u.handleRequest(buffer[:n-1])
-
-		conn.WriteToUDP(res, cAddr)
+		req := make([]byte, n)
+		copy(req, buffer[:n])
 
-		if err != nil {
-			fmt.Println("error occurred", err)
+		// Shutdown waits for the queries being handled, so none may start
+		// once it has begun.
+		u.mu.Lock()
+		if u.closing {
+			u.mu.Unlock()
+			return nil
 		}
+		u.queries.Add(1)
+		u.mu.Unlock()
+
+		go func() {
+			defer u.queries.Done()
+			res := u.handleRequest(req)
+			if res == nil {
+				return
+			}
+			if _, err := conn.WriteToUDP(res, cAddr); err != nil {
+				u.logger.Println("error occurred", err)
+			}
+		}()
+	}
+}
+
+// Close stops the server from receiving queries.
+func (u *UDPServer) Close() error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.closing = true
+	if u.conn == nil {
+		return nil
+	}
+	return u.conn.Close()
+}
+
+// Shutdown stops the server from receiving queries and waits for the queries
+// it is handling to be answered before closing it. If ctx is done first the
+// server is closed without waiting any longer.
+func (u *UDPServer) Shutdown(ctx context.Context) error {
+	u.mu.Lock()
+	u.closing = true
+	conn := u.conn
+	u.mu.Unlock()
+	if conn == nil {
+		return nil
+	}
+
+	// Wake up Listen, which returns once it sees the server is closing.
+	if err := conn.SetReadDeadline(time.Now()); err != nil {
+		return err
+	}
+
+	done := make(chan struct{})
+	go func() {
+		u.queries.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	if cerr := conn.Close(); err == nil {
+		err = cerr
 	}
+	return err
+}
+
+// SetResolver changes the resolver that answers the queries received from
+// now on.
+func (u *UDPServer) SetResolver(r *resolver.Resolver) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.r = r
+}
+
+func (u *UDPServer) resolver() *resolver.Resolver {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.r
+}
+
+func (u *UDPServer) isClosing() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return u.closing
 }
 
 func (u *UDPServer) handleRequest(buffer []byte) []byte {
-	return nil
+	resp, ok := network.HandleMessage(u.resolver(), buffer)
+	if !ok {
+		return nil
+	}
+
+	res, err := dns.EncodeUDPPacket(resp)
+	if err != nil {
+		u.logger.Println("error occurred", err)
+		return nil
+	}
+
+	return res.Bytes
 }
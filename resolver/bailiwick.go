@@ -0,0 +1,86 @@
+package resolver
+
+import (
+	"github.com/davidseybold/dns-resolver/dns"
+)
+
+// scrub removes the records of a response that the server which sent it has
+// no business giving, before any of them are cached. A server is only trusted
+// for names in zone, the zone it was asked as a server for, and only records
+// that bear on the question are kept:
+//
+//   - answers owned by the name asked about, or by the target of a CNAME
+//     record kept before them,
+//   - NS and SOA records in the authority section for zone or a zone
+//     between it and one of those owners, but not for sibling zones,
+//   - A and AAAA records in the additional section for the name servers
+//     named by the NS records kept in either section.
+//
+// Any of these outside zone are dropped too, which keeps a server from
+// poisoning the cache with data for names it is not authoritative for.
+func scrub(resp dns.Packet, name, zone dns.Name) dns.Packet {
+	owners := []dns.Name{name}
+	nsNames := []dns.Name{}
+	answers := []dns.ResourceRecord{}
+	for _, rec := range resp.Answers {
+		if !rec.Name.IsSubdomainOf(zone) || !containsName(owners, rec.Name) {
+			continue
+		}
+		answers = append(answers, rec)
+		if ns, ok := rec.Data.(*dns.NSRecordData); ok && rec.Type == dns.TypeNS {
+			nsNames = append(nsNames, ns.Name)
+		}
+		if cname, ok := rec.Data.(*dns.CNameRecordData); ok && rec.Type == dns.TypeCNAME && !containsName(owners, cname.Name) {
+			owners = append(owners, cname.Name)
+		}
+	}
+
+	authorities := []dns.ResourceRecord{}
+	for _, rec := range resp.Authorities {
+		if rec.Type != dns.TypeNS && rec.Type != dns.TypeSOA {
+			continue
+		}
+		if !rec.Name.IsSubdomainOf(zone) || !enclosesAny(rec.Name, owners) {
+			continue
+		}
+		authorities = append(authorities, rec)
+		if ns, ok := rec.Data.(*dns.NSRecordData); ok && rec.Type == dns.TypeNS {
+			nsNames = append(nsNames, ns.Name)
+		}
+	}
+
+	additional := []dns.ResourceRecord{}
+	for _, rec := range resp.Additional {
+		if rec.Type != dns.TypeA && rec.Type != dns.TypeAAAA {
+			continue
+		}
+		if !rec.Name.IsSubdomainOf(zone) || !containsName(nsNames, rec.Name) {
+			continue
+		}
+		additional = append(additional, rec)
+	}
+
+	resp.Answers = answers
+	resp.Authorities = authorities
+	resp.Additional = additional
+	return resp
+}
+
+func containsName(names []dns.Name, name dns.Name) bool {
+	for _, n := range names {
+		if n.Equals(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// enclosesAny reports whether one of names is zone or a subdomain of it.
+func enclosesAny(zone dns.Name, names []dns.Name) bool {
+	for _, n := range names {
+		if n.IsSubdomainOf(zone) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,169 @@
+package resolver
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/davidseybold/dns-resolver/dns"
+)
+
+func TestScrub(t *testing.T) {
+	tests := []struct {
+		name string
+		// The response is to a query for www.example.com. sent to the
+		// servers of zone.
+		zone string
+		resp dns.Packet
+		want dns.Packet
+	}{
+		{
+			name: "answer in zone",
+			zone: "example.com.",
+			resp: dns.Packet{Answers: []dns.ResourceRecord{testA("www.example.com.", "192.0.2.1")}},
+			want: dns.Packet{Answers: []dns.ResourceRecord{testA("www.example.com.", "192.0.2.1")}},
+		},
+		{
+			name: "answer out of zone",
+			zone: "example.com.",
+			resp: dns.Packet{Answers: []dns.ResourceRecord{
+				testA("www.example.com.", "192.0.2.1"),
+				testA("www.bank.test.", "192.0.2.66"),
+			}},
+			want: dns.Packet{Answers: []dns.ResourceRecord{testA("www.example.com.", "192.0.2.1")}},
+		},
+		{
+			name: "answer for another name in zone",
+			zone: "example.com.",
+			resp: dns.Packet{Answers: []dns.ResourceRecord{
+				testA("www.example.com.", "192.0.2.1"),
+				testA("mail.example.com.", "192.0.2.66"),
+			}},
+			want: dns.Packet{Answers: []dns.ResourceRecord{testA("www.example.com.", "192.0.2.1")}},
+		},
+		{
+			name: "cname target in zone",
+			zone: "example.com.",
+			resp: dns.Packet{Answers: []dns.ResourceRecord{
+				testCNAME("www.example.com.", "web.example.com."),
+				testA("web.example.com.", "192.0.2.1"),
+			}},
+			want: dns.Packet{Answers: []dns.ResourceRecord{
+				testCNAME("www.example.com.", "web.example.com."),
+				testA("web.example.com.", "192.0.2.1"),
+			}},
+		},
+		{
+			name: "cname target out of zone",
+			zone: "example.com.",
+			resp: dns.Packet{Answers: []dns.ResourceRecord{
+				testCNAME("www.example.com.", "www.bank.test."),
+				testA("www.bank.test.", "192.0.2.66"),
+			}},
+			want: dns.Packet{Answers: []dns.ResourceRecord{
+				testCNAME("www.example.com.", "www.bank.test."),
+			}},
+		},
+		{
+			name: "referral to a child zone",
+			zone: "com.",
+			resp: dns.Packet{
+				Authorities: []dns.ResourceRecord{testNS("example.com.", "ns.example.com.")},
+				Additional:  []dns.ResourceRecord{testA("ns.example.com.", "192.0.2.53")},
+			},
+			want: dns.Packet{
+				Authorities: []dns.ResourceRecord{testNS("example.com.", "ns.example.com.")},
+				Additional:  []dns.ResourceRecord{testA("ns.example.com.", "192.0.2.53")},
+			},
+		},
+		{
+			name: "ns records for a sibling zone",
+			zone: "com.",
+			resp: dns.Packet{
+				Authorities: []dns.ResourceRecord{
+					testNS("example.com.", "ns.example.com."),
+					testNS("bank.com.", "ns.evil.com."),
+				},
+				Additional: []dns.ResourceRecord{
+					testA("ns.example.com.", "192.0.2.53"),
+					testA("ns.evil.com.", "192.0.2.66"),
+				},
+			},
+			want: dns.Packet{
+				Authorities: []dns.ResourceRecord{testNS("example.com.", "ns.example.com.")},
+				Additional:  []dns.ResourceRecord{testA("ns.example.com.", "192.0.2.53")},
+			},
+		},
+		{
+			name: "ns records above the zone",
+			zone: "example.com.",
+			resp: dns.Packet{Authorities: []dns.ResourceRecord{testNS("com.", "ns.evil.test.")}},
+			want: dns.Packet{},
+		},
+		{
+			name: "glue for a name that is not a name server",
+			zone: "com.",
+			resp: dns.Packet{
+				Authorities: []dns.ResourceRecord{testNS("example.com.", "ns.example.com.")},
+				Additional: []dns.ResourceRecord{
+					testA("ns.example.com.", "192.0.2.53"),
+					testA("www.example.com.", "192.0.2.66"),
+				},
+			},
+			want: dns.Packet{
+				Authorities: []dns.ResourceRecord{testNS("example.com.", "ns.example.com.")},
+				Additional:  []dns.ResourceRecord{testA("ns.example.com.", "192.0.2.53")},
+			},
+		},
+		{
+			name: "glue out of bailiwick",
+			zone: "com.",
+			resp: dns.Packet{
+				Authorities: []dns.ResourceRecord{testNS("example.com.", "ns.example.net.")},
+				Additional:  []dns.ResourceRecord{testA("ns.example.net.", "192.0.2.66")},
+			},
+			want: dns.Packet{
+				Authorities: []dns.ResourceRecord{testNS("example.com.", "ns.example.net.")},
+			},
+		},
+		{
+			name: "soa of the zone",
+			zone: "example.com.",
+			resp: dns.Packet{Authorities: []dns.ResourceRecord{testSOA("example.com.")}},
+			want: dns.Packet{Authorities: []dns.ResourceRecord{testSOA("example.com.")}},
+		},
+		{
+			name: "soa of another zone",
+			zone: "example.com.",
+			resp: dns.Packet{Authorities: []dns.ResourceRecord{testSOA("bank.test.")}},
+			want: dns.Packet{},
+		},
+		{
+			name: "other records in the authority section",
+			zone: "example.com.",
+			resp: dns.Packet{Authorities: []dns.ResourceRecord{testA("www.example.com.", "192.0.2.66")}},
+			want: dns.Packet{},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := scrub(tt.resp, dns.NewName("www.example.com."), dns.NewName(tt.zone))
+
+			want := tt.want
+			for _, section := range []*[]dns.ResourceRecord{&want.Answers, &want.Authorities, &want.Additional} {
+				if *section == nil {
+					*section = []dns.ResourceRecord{}
+				}
+			}
+			if !reflect.DeepEqual(got.Answers, want.Answers) {
+				t.Errorf("scrub() answers = %v, want %v", got.Answers, want.Answers)
+			}
+			if !reflect.DeepEqual(got.Authorities, want.Authorities) {
+				t.Errorf("scrub() authorities = %v, want %v", got.Authorities, want.Authorities)
+			}
+			if !reflect.DeepEqual(got.Additional, want.Additional) {
+				t.Errorf("scrub() additional = %v, want %v", got.Additional, want.Additional)
+			}
+		})
+	}
+}
@@ -1,110 +1,351 @@
 package cache
 
 import (
-	"fmt"
+	"container/list"
 	"sync"
 	"time"
 
-	hashstructure "github.com/mitchellh/hashstructure/v2"
-
 	"github.com/davidseybold/dns-resolver/dns"
 )
 
-type cacheRecord struct {
-	ExpirationTime time.Time
-	ResourceRecord dns.ResourceRecord
+const (
+	// DefaultMaxEntries is the number of RRsets and negative responses kept
+	// unless WithMaxEntries says otherwise.
+	DefaultMaxEntries = 100000
+	// DefaultMaxSize is the approximate number of bytes the cached entries
+	// may take up unless WithMaxSize says otherwise.
+	DefaultMaxSize = 64 << 20
+	// DefaultSweepInterval is how often expired entries are removed unless
+	// WithSweepInterval says otherwise.
+	DefaultSweepInterval = time.Minute
+
+	// entryOverhead approximates the memory used by an entry besides its
+	// records: the map slot, list element and bookkeeping.
+	entryOverhead = 128
+	// recordOverhead approximates the memory used by a record besides its
+	// owner name and data.
+	recordOverhead = 48
+)
+
+// A Key identifies an RRset: the records sharing an owner name, type and
+// class (RFC 2181 §5).
+type Key struct {
+	// Name is the owner name in lower case, since names are compared case
+	// insensitively.
+	Name  string
+	Type  dns.Type
+	Class dns.Class
 }
 
-func (c cacheRecord) Hash() string {
-	hash, _ := hashstructure.Hash(c.ResourceRecord, hashstructure.FormatV2, nil)
-	return fmt.Sprint(hash)
+// NewKey returns the key of the RRset of name, type t and class c.
+func NewKey(name dns.Name, t dns.Type, c dns.Class) Key {
+	return Key{Name: name.LowerString(), Type: t, Class: c}
 }
 
-func (c cacheRecord) IsExpired() bool {
-	return c.ExpirationTime.After(time.Now())
+// entry is a cached RRset, or a negative response if negative is set. The
+// records of an RRset all expire together.
+type entry struct {
+	key      Key
+	negative bool
+	size     int
+
+	ExpirationTime time.Time
+	Credibility    Credibility
+	Records        []dns.ResourceRecord
+	Response       NegativeResponse
 }
 
+func (e *entry) IsExpired(now time.Time) bool {
+	return !e.ExpirationTime.After(now)
+}
+
+// Cache holds RRsets and negative responses until they expire. When it is
+// full the least recently used entries are evicted to make room.
 type Cache struct {
-	mu *sync.RWMutex
-	c  map[string]recordSet
+	mu       *sync.Mutex
+	c        map[Key]*list.Element
+	negative map[Key]*list.Element
+	// lru orders the entries from the most to the least recently used.
+	lru  *list.List
+	size int
+
+	maxTTL        time.Duration
+	maxEntries    int
+	maxSize       int
+	sweepInterval time.Duration
+
+	done      chan struct{}
+	closeOnce sync.Once
 }
 
-func New() *Cache {
-	return &Cache{
-		mu: &sync.RWMutex{},
-		c:  make(map[string]recordSet),
+// Option configures a Cache.
+type Option func(*Cache)
+
+// WithMaxTTL limits how long records are kept, whatever their TTL.
+func WithMaxTTL(d time.Duration) Option {
+	return func(c *Cache) {
+		c.maxTTL = d
 	}
 }
 
-func (r *Cache) Get(name string) ([]dns.ResourceRecord, bool) {
-	cacheRecords, ok := r.get(name)
-	if !ok {
-		return []dns.ResourceRecord{}, false
+// WithMaxEntries limits the number of RRsets and negative responses kept.
+// Zero means no limit.
+func WithMaxEntries(n int) Option {
+	return func(c *Cache) {
+		c.maxEntries = n
+	}
+}
+
+// WithMaxSize limits the approximate number of bytes taken up by the cached
+// entries. Zero means no limit.
+func WithMaxSize(bytes int) Option {
+	return func(c *Cache) {
+		c.maxSize = bytes
+	}
+}
+
+// WithSweepInterval sets how often expired entries are removed. Zero means
+// they are only removed when they are looked up or evicted.
+func WithSweepInterval(d time.Duration) Option {
+	return func(c *Cache) {
+		c.sweepInterval = d
 	}
+}
 
-	dnsRecords := []dns.ResourceRecord{}
-	for _, cRec := range cacheRecords {
-		dnsRecords = append(dnsRecords, cRec.ResourceRecord)
+// New creates a cache. Unless the sweep interval is zero it starts a
+// goroutine removing expired entries, which runs until the cache is closed.
+func New(opts ...Option) *Cache {
+	c := &Cache{
+		mu:            &sync.Mutex{},
+		c:             make(map[Key]*list.Element),
+		negative:      make(map[Key]*list.Element),
+		lru:           list.New(),
+		maxEntries:    DefaultMaxEntries,
+		maxSize:       DefaultMaxSize,
+		sweepInterval: DefaultSweepInterval,
+		done:          make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(c)
 	}
+	if c.sweepInterval > 0 {
+		go c.sweep()
+	}
+	return c
+}
 
-	return dnsRecords, len(dnsRecords) > 0
+// Close stops removing expired entries in the background. The cache can
+// still be used.
+func (r *Cache) Close() {
+	r.closeOnce.Do(func() {
+		close(r.done)
+	})
 }
 
-func (r *Cache) get(name string) ([]cacheRecord, bool) {
+// Len returns the number of RRsets and negative responses cached.
+func (r *Cache) Len() int {
 	r.mu.Lock()
 	defer r.mu.Unlock()
+	return r.lru.Len()
+}
 
-	set, ok := r.c[name]
-	if !ok {
-		return []cacheRecord{}, false
-	}
-	cacheRecords := set.Records()
+// Size returns the approximate number of bytes taken up by the cached
+// entries.
+func (r *Cache) Size() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.size
+}
+
+// Add caches the records with the given credibility, replacing any cached
+// RRsets they belong to unless those are more credible. An RRset whose
+// records have different TTLs is kept for the smallest of them (RFC 2181
+// §5.2), and duplicate records are dropped.
+func (r *Cache) Add(cred Credibility, records ...dns.ResourceRecord) {
+	sets := make(map[Key][]dns.ResourceRecord)
+	sizes := make(map[Key]int)
+	seen := make(map[Key]map[string]bool)
+	order := []Key{}
+	for _, rec := range records {
+		key := NewKey(rec.Name, rec.Type, rec.Class)
+		if _, ok := sets[key]; !ok {
+			order = append(order, key)
+			sizes[key] = entryOverhead + len(key.Name)
+			seen[key] = make(map[string]bool)
+		}
 
-	validRecords := []cacheRecord{}
-	for i := range cacheRecords {
-		if cacheRecords[i].IsExpired() {
-			set.Delete(cacheRecords[i])
-		} else {
-			validRecords = append(validRecords, cacheRecords[i])
+		data, err := dns.CanonicalRecordData(rec.Data)
+		if err == nil {
+			if seen[key][string(data)] {
+				continue
+			}
+			seen[key][string(data)] = true
 		}
+		sets[key] = append(sets[key], rec)
+		sizes[key] += recordOverhead + nameSize(rec.Name) + len(data)
 	}
 
-	return validRecords, len(validRecords) > 0
-}
+	now := time.Now()
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, key := range order {
+		recs := sets[key]
+		ttl := recs[0].TTL
+		for _, rec := range recs[1:] {
+			if rec.TTL < ttl {
+				ttl = rec.TTL
+			}
+		}
+
+		if cur, ok := r.c[key]; ok {
+			if e := cur.Value.(*entry); !e.IsExpired(now) && e.Credibility > cred {
+				continue
+			}
+		}
 
-func (r *Cache) Add(name string, records ...dns.ResourceRecord) {
-	timeIn := time.Now()
-	cacheRecords := []cacheRecord{}
-	for i := range records {
-		cacheRecords = append(cacheRecords, cacheRecord{
-			ExpirationTime: timeIn.Add(time.Duration(records[i].TTL) * time.Second),
-			ResourceRecord: records[i],
+		// Records trusted enough to answer with are newer than any negative
+		// response for them.
+		if cred >= CredibilityAnswer {
+			r.removeKey(r.negative, nameErrorKey(key.Name, key.Class))
+			r.removeKey(r.negative, key)
+		}
+
+		r.insert(r.c, &entry{
+			key:            key,
+			size:           sizes[key],
+			ExpirationTime: now.Add(r.ttl(ttl)),
+			Credibility:    cred,
+			Records:        recs,
 		})
 	}
-	r.add(name, cacheRecords)
 }
 
-func (r *Cache) add(name string, cr []cacheRecord) {
+// Query returns the cached RRset of name, type qType and class qClass if it
+// is at least as credible as min. The TTL of each record is set to the time
+// left until the RRset expires.
+func (r *Cache) Query(name dns.Name, qType dns.Type, qClass dns.Class, min Credibility) ([]dns.ResourceRecord, bool) {
+	now := time.Now()
 	r.mu.Lock()
-	defer r.mu.Unlock()
+	e, ok := r.lookup(r.c, NewKey(name, qType, qClass), now)
+	r.mu.Unlock()
+	if !ok || e.Credibility < min {
+		return []dns.ResourceRecord{}, false
+	}
 
-	_, ok := r.c[name]
-	if !ok {
-		r.c[name] = make(recordSet)
+	ttl := uint32(e.ExpirationTime.Sub(now) / time.Second)
+	records := make([]dns.ResourceRecord, len(e.Records))
+	for i, rec := range e.Records {
+		rec.TTL = ttl
+		records[i] = rec
 	}
-	r.c[name].Add(cr...)
+	return records, true
 }
 
-func (r *Cache) Query(name string, qType dns.Type, qclass dns.Class) ([]dns.ResourceRecord, bool) {
-	records, ok := r.Get(name)
+// lookup finds the entry for key in m, marking it as the most recently used.
+// An expired entry is removed instead. r.mu must be held.
+func (r *Cache) lookup(m map[Key]*list.Element, key Key, now time.Time) (*entry, bool) {
+	elem, ok := m[key]
 	if !ok {
-		return []dns.ResourceRecord{}, false
+		return nil, false
+	}
+	e := elem.Value.(*entry)
+	if e.IsExpired(now) {
+		r.remove(elem)
+		return nil, false
+	}
+	r.lru.MoveToFront(elem)
+	return e, true
+}
+
+// insert adds e to m, replacing any entry with the same key, and evicts the
+// least recently used entries until the cache is within its limits. An entry
+// too large to ever fit is not added. r.mu must be held.
+func (r *Cache) insert(m map[Key]*list.Element, e *entry) {
+	r.removeKey(m, e.key)
+	if r.maxSize > 0 && e.size > r.maxSize {
+		return
+	}
+
+	m[e.key] = r.lru.PushFront(e)
+	r.size += e.size
+
+	for r.overLimit() {
+		r.remove(r.lru.Back())
+	}
+}
+
+func (r *Cache) overLimit() bool {
+	return (r.maxEntries > 0 && r.lru.Len() > r.maxEntries) ||
+		(r.maxSize > 0 && r.size > r.maxSize)
+}
+
+// removeKey removes the entry for key from m, if there is one. r.mu must be
+// held.
+func (r *Cache) removeKey(m map[Key]*list.Element, key Key) {
+	if elem, ok := m[key]; ok {
+		r.remove(elem)
 	}
-	filteredRecords := []dns.ResourceRecord{}
-	for i := range records {
-		if records[i].Class == qclass && records[i].Type == qType {
-			filteredRecords = append(filteredRecords, records[i])
+}
+
+// remove removes an entry from the cache. r.mu must be held.
+func (r *Cache) remove(elem *list.Element) {
+	e := r.lru.Remove(elem).(*entry)
+	if e.negative {
+		delete(r.negative, e.key)
+	} else {
+		delete(r.c, e.key)
+	}
+	r.size -= e.size
+}
+
+// sweep removes expired entries every sweep interval until the cache is
+// closed.
+func (r *Cache) sweep() {
+	ticker := time.NewTicker(r.sweepInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case now := <-ticker.C:
+			r.removeExpired(now)
 		}
 	}
-	return filteredRecords, len(filteredRecords) > 0
+}
+
+func (r *Cache) removeExpired(now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for elem := r.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if elem.Value.(*entry).IsExpired(now) {
+			r.remove(elem)
+		}
+		elem = next
+	}
+}
+
+// ttl limits a record's TTL to the maximum.
+func (r *Cache) ttl(ttl uint32) time.Duration {
+	d := time.Duration(ttl) * time.Second
+	if r.maxTTL > 0 && d > r.maxTTL {
+		return r.maxTTL
+	}
+	return d
+}
+
+// recordSize approximates the memory used by a record, counting its owner
+// name and the wire length of its data.
+func recordSize(rec dns.ResourceRecord) int {
+	data, _ := dns.CanonicalRecordData(rec.Data)
+	return recordOverhead + nameSize(rec.Name) + len(data)
+}
+
+// nameSize approximates the memory used by a name, each label being a slice.
+func nameSize(name dns.Name) int {
+	size := 0
+	for _, label := range name {
+		size += len(label) + 24
+	}
+	return size
 }
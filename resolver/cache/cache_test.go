@@ -0,0 +1,242 @@
+package cache
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/davidseybold/dns-resolver/dns"
+)
+
+func aRecord(name string, ttl uint32, addr string) dns.ResourceRecord {
+	return dns.ResourceRecord{
+		Name:  dns.NewName(name),
+		Type:  dns.TypeA,
+		Class: dns.ClassIN,
+		TTL:   ttl,
+		Data:  &dns.ARecordData{Address: net.ParseIP(addr)},
+	}
+}
+
+func nsRecord(name string, ttl uint32, host string) dns.ResourceRecord {
+	data := &dns.NSRecordData{}
+	data.Name = dns.NewName(host)
+	return dns.ResourceRecord{
+		Name:  dns.NewName(name),
+		Type:  dns.TypeNS,
+		Class: dns.ClassIN,
+		TTL:   ttl,
+		Data:  data,
+	}
+}
+
+// addresses returns the addresses of the cached A records of name.
+func addresses(c *Cache, name string, min Credibility) []string {
+	records, ok := c.Query(dns.NewName(name), dns.TypeA, dns.ClassIN, min)
+	if !ok {
+		return nil
+	}
+	addrs := make([]string, len(records))
+	for i, rec := range records {
+		addrs[i] = rec.Data.(*dns.ARecordData).Address.String()
+	}
+	return addrs
+}
+
+func TestAddDuplicates(t *testing.T) {
+	tests := []struct {
+		name    string
+		records []dns.ResourceRecord
+		want    int
+	}{
+		{
+			name: "identical",
+			records: []dns.ResourceRecord{
+				aRecord("example.", 60, "192.0.2.1"),
+				aRecord("example.", 60, "192.0.2.1"),
+			},
+			want: 1,
+		},
+		{
+			name: "names in rdata differ in case",
+			records: []dns.ResourceRecord{
+				nsRecord("example.", 60, "ns.example."),
+				nsRecord("example.", 60, "NS.Example."),
+			},
+			want: 1,
+		},
+		{
+			name: "different",
+			records: []dns.ResourceRecord{
+				nsRecord("example.", 60, "a.example."),
+				nsRecord("example.", 60, "b.example."),
+			},
+			want: 2,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(WithSweepInterval(0))
+			c.Add(CredibilityAnswer, tt.records...)
+
+			rec := tt.records[0]
+			got, ok := c.Query(rec.Name, rec.Type, rec.Class, CredibilityAnswer)
+			if !ok || len(got) != tt.want {
+				t.Errorf("Query() = %v, %v, want %d records", got, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryExpired(t *testing.T) {
+	tests := []struct {
+		name string
+		opts []Option
+		ttl  uint32
+		wait time.Duration
+		want bool
+	}{
+		{name: "live", ttl: 60, want: true},
+		{name: "zero ttl", ttl: 0, want: false},
+		{
+			name: "ttl limited by max ttl",
+			opts: []Option{WithMaxTTL(time.Millisecond)},
+			ttl:  60,
+			wait: 10 * time.Millisecond,
+			want: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(append([]Option{WithSweepInterval(0)}, tt.opts...)...)
+			c.Add(CredibilityAnswer, aRecord("example.", tt.ttl, "192.0.2.1"))
+			time.Sleep(tt.wait)
+
+			if got := addresses(c, "example.", CredibilityAnswer) != nil; got != tt.want {
+				t.Errorf("Query() found = %v, want %v", got, tt.want)
+			}
+			if !tt.want && c.Len() != 0 {
+				t.Errorf("Len() = %d after querying an expired entry, want 0", c.Len())
+			}
+		})
+	}
+}
+
+func TestRemoveExpired(t *testing.T) {
+	c := New(WithSweepInterval(0))
+	c.Add(CredibilityAnswer, aRecord("a.example.", 60, "192.0.2.1"))
+	c.Add(CredibilityAnswer, aRecord("b.example.", 3600, "192.0.2.2"))
+
+	c.removeExpired(time.Now().Add(time.Hour / 2))
+	if got := c.Len(); got != 1 {
+		t.Fatalf("Len() = %d, want 1", got)
+	}
+	if got := addresses(c, "b.example.", CredibilityAnswer); got == nil {
+		t.Errorf("unexpired entry was removed")
+	}
+}
+
+func TestEvictLeastRecentlyUsed(t *testing.T) {
+	c := New(WithSweepInterval(0), WithMaxEntries(2))
+	c.Add(CredibilityAnswer, aRecord("a.example.", 60, "192.0.2.1"))
+	c.Add(CredibilityAnswer, aRecord("b.example.", 60, "192.0.2.2"))
+	// Using a makes b the least recently used.
+	addresses(c, "a.example.", CredibilityAnswer)
+	c.Add(CredibilityAnswer, aRecord("c.example.", 60, "192.0.2.3"))
+
+	if got := c.Len(); got != 2 {
+		t.Errorf("Len() = %d, want 2", got)
+	}
+	for name, want := range map[string]bool{"a.example.": true, "b.example.": false, "c.example.": true} {
+		if got := addresses(c, name, CredibilityAnswer) != nil; got != want {
+			t.Errorf("%s cached = %v, want %v", name, got, want)
+		}
+	}
+}
+
+func TestEvictBySize(t *testing.T) {
+	c := New(WithSweepInterval(0), WithMaxEntries(0))
+	c.Add(CredibilityAnswer, aRecord("a.example.", 60, "192.0.2.1"))
+	size := c.Size()
+
+	c = New(WithSweepInterval(0), WithMaxEntries(0), WithMaxSize(size*2))
+	c.Add(CredibilityAnswer, aRecord("a.example.", 60, "192.0.2.1"))
+	c.Add(CredibilityAnswer, aRecord("b.example.", 60, "192.0.2.2"))
+	c.Add(CredibilityAnswer, aRecord("c.example.", 60, "192.0.2.3"))
+
+	if got := c.Size(); got > size*2 {
+		t.Errorf("Size() = %d, want at most %d", got, size*2)
+	}
+	if got := addresses(c, "a.example.", CredibilityAnswer); got != nil {
+		t.Errorf("least recently used entry was not evicted")
+	}
+	if got := addresses(c, "c.example.", CredibilityAnswer); got == nil {
+		t.Errorf("most recently added entry was evicted")
+	}
+}
+
+func TestAddCredibility(t *testing.T) {
+	tests := []struct {
+		name     string
+		first    Credibility
+		firstTTL uint32
+		second   Credibility
+		want     string
+	}{
+		{
+			name:     "more credible replaces",
+			first:    CredibilityGlue,
+			firstTTL: 60,
+			second:   CredibilityAuthAnswer,
+			want:     "192.0.2.2",
+		},
+		{
+			name:     "equally credible replaces",
+			first:    CredibilityAnswer,
+			firstTTL: 60,
+			second:   CredibilityAnswer,
+			want:     "192.0.2.2",
+		},
+		{
+			name:     "less credible does not replace",
+			first:    CredibilityAuthAnswer,
+			firstTTL: 60,
+			second:   CredibilityAdditional,
+			want:     "192.0.2.1",
+		},
+		{
+			name:     "less credible replaces expired",
+			first:    CredibilityAuthAnswer,
+			firstTTL: 0,
+			second:   CredibilityAdditional,
+			want:     "192.0.2.2",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := New(WithSweepInterval(0))
+			c.Add(tt.first, aRecord("example.", tt.firstTTL, "192.0.2.1"))
+			c.Add(tt.second, aRecord("example.", 60, "192.0.2.2"))
+
+			got := addresses(c, "example.", CredibilityAdditional)
+			if len(got) != 1 || got[0] != tt.want {
+				t.Errorf("Query() = %v, want [%s]", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestQueryMinCredibility(t *testing.T) {
+	c := New(WithSweepInterval(0))
+	c.Add(CredibilityGlue, aRecord("example.", 60, "192.0.2.1"))
+
+	if got := addresses(c, "example.", CredibilityGlue); len(got) != 1 {
+		t.Errorf("Query(glue) = %v, want one record", got)
+	}
+	if got := addresses(c, "example.", CredibilityAnswer); got != nil {
+		t.Errorf("Query(answer) = %v, want a miss", got)
+	}
+}
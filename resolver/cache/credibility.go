@@ -0,0 +1,41 @@
+package cache
+
+// Credibility ranks how far cached data can be trusted, based on where in a
+// response it was found (RFC 2181 §5.4.1). Data is never replaced by data of
+// lower credibility until it expires.
+type Credibility int
+
+const (
+	// CredibilityAdditional is data from the additional section of a
+	// non-authoritative response.
+	CredibilityAdditional Credibility = iota + 1
+	// CredibilityGlue is data from the authority section of a
+	// non-authoritative response, such as the NS records of a referral, and
+	// from the additional section of an authoritative response.
+	CredibilityGlue
+	// CredibilityAnswer is data from the answer section of a
+	// non-authoritative response, and answer data an authoritative response
+	// is not authoritative for, such as the targets of its CNAME records.
+	CredibilityAnswer
+	// CredibilityAuthAuthority is data from the authority section of an
+	// authoritative response.
+	CredibilityAuthAuthority
+	// CredibilityAuthAnswer is authoritative data from the answer section of
+	// an authoritative response.
+	CredibilityAuthAnswer
+)
+
+var credibilityNames = map[Credibility]string{
+	CredibilityAdditional:    "additional",
+	CredibilityGlue:          "glue",
+	CredibilityAnswer:        "answer",
+	CredibilityAuthAuthority: "authoritative authority",
+	CredibilityAuthAnswer:    "authoritative answer",
+}
+
+func (c Credibility) String() string {
+	if name, ok := credibilityNames[c]; ok {
+		return name
+	}
+	return "unknown"
+}
@@ -0,0 +1,72 @@
+package cache
+
+import (
+	"time"
+
+	"github.com/davidseybold/dns-resolver/dns"
+)
+
+// A NegativeResponse records that a name does not exist, or that it has no
+// records of a type, along with the SOA record of the zone that said so
+// (RFC 2308).
+type NegativeResponse struct {
+	// NameError is set if the name does not exist, in which case the
+	// response applies to every type.
+	NameError bool
+	SOA       dns.ResourceRecord
+}
+
+// AddNegative caches a negative response for a question. It is kept for the
+// smaller of the TTL of the SOA record and its MINIMUM field (RFC 2308 §5).
+func (r *Cache) AddNegative(name dns.Name, qType dns.Type, qClass dns.Class, resp NegativeResponse) {
+	soa, ok := resp.SOA.Data.(*dns.SOARecordData)
+	if !ok {
+		return
+	}
+	ttl := resp.SOA.TTL
+	if soa.Minimum < ttl {
+		ttl = soa.Minimum
+	}
+
+	key := NewKey(name, qType, qClass)
+	if resp.NameError {
+		key = nameErrorKey(key.Name, qClass)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.insert(r.negative, &entry{
+		key:            key,
+		negative:       true,
+		size:           entryOverhead + len(key.Name) + recordSize(resp.SOA),
+		ExpirationTime: time.Now().Add(r.ttl(ttl)),
+		Response:       resp,
+	})
+}
+
+// QueryNegative returns the cached negative response for the question, if
+// any. The TTL of the SOA record is set to the time left until it expires.
+func (r *Cache) QueryNegative(name dns.Name, qType dns.Type, qClass dns.Class) (NegativeResponse, bool) {
+	key := NewKey(name, qType, qClass)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	for _, key := range []Key{nameErrorKey(key.Name, qClass), key} {
+		e, ok := r.lookup(r.negative, key, now)
+		if !ok {
+			continue
+		}
+		resp := e.Response
+		resp.SOA.TTL = uint32(e.ExpirationTime.Sub(now) / time.Second)
+		return resp, true
+	}
+	return NegativeResponse{}, false
+}
+
+// nameErrorKey returns the key a name error is cached under. Type 0 is never
+// used by a record, so it cannot clash with a negative response for a type.
+func nameErrorKey(name string, class dns.Class) Key {
+	return Key{Name: name, Class: class}
+}
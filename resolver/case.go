@@ -0,0 +1,144 @@
+package resolver
+
+import (
+	"context"
+	"crypto/rand"
+	"errors"
+	"net"
+	"time"
+
+	"github.com/davidseybold/dns-resolver/dns"
+	"github.com/davidseybold/dns-resolver/resolver/transport"
+)
+
+const (
+	// caseFallbackTTL is how long a server found not to echo the case of
+	// query names is sent them unchanged before it is tried again.
+	caseFallbackTTL = time.Hour
+	// caseMismatchLimit is how many responses in a row must fail to echo the
+	// case of query names before a server is sent them unchanged, so that a
+	// few forged responses cannot turn the protection off.
+	caseMismatchLimit = 3
+)
+
+// caseState is what is known about whether a server echoes the case of
+// query names.
+type caseState struct {
+	// mismatches counts the exchanges in a row whose only response did not
+	// echo the case of the query name.
+	mismatches int
+	// fallbackUntil is when the server is next sent names in random case,
+	// if it was found not to echo their case.
+	fallbackUntil time.Time
+}
+
+// WithCaseRandomization makes the resolver send the letters of query names
+// in random case and only accept responses that echo the same case, which
+// makes forged responses harder to get accepted (DNS 0x20). Servers that
+// repeatedly fail to preserve case are sent names unchanged for a while.
+func WithCaseRandomization() Option {
+	return func(r *Resolver) {
+		r.randomizeCase = true
+	}
+}
+
+// exchange sends the query to the name server at addr. If case
+// randomization is on and the server preserves case, the query name is sent
+// in random case and only a response echoing it exactly is accepted. The
+// response is returned with the query name in its original case.
+func (r *Resolver) exchange(ctx context.Context, addr net.IP, query dns.Packet) (dns.Packet, error) {
+	if !r.randomizeCase || !r.preservesCase(addr) {
+		return r.transport.Exchange(ctx, transport.Address(addr), query)
+	}
+
+	name := query.Questions[0].Name
+	mixed := query
+	mixed.Questions = []dns.Question{query.Questions[0]}
+	mixed.Questions[0].Name = randomCase(name)
+
+	resp, err := r.transport.ExchangeExactCase(ctx, transport.Address(addr), mixed)
+	if errors.Is(err, transport.ErrCaseMismatch) {
+		r.caseMismatch(addr)
+	}
+	if err != nil {
+		return resp, err
+	}
+	r.caseMatch(addr)
+	return restoreCase(resp, name), nil
+}
+
+// preservesCase reports whether the server at addr is sent names in random
+// case.
+func (r *Resolver) preservesCase(addr net.IP) bool {
+	r.caseMu.Lock()
+	defer r.caseMu.Unlock()
+	state, ok := r.caseStates[addr.String()]
+	return !ok || !state.fallbackUntil.After(time.Now())
+}
+
+// caseMismatch records that the server at addr did not echo the case of a
+// query name, falling back to sending it names unchanged once it has
+// happened caseMismatchLimit times in a row.
+func (r *Resolver) caseMismatch(addr net.IP) {
+	r.caseMu.Lock()
+	defer r.caseMu.Unlock()
+	state, ok := r.caseStates[addr.String()]
+	if !ok {
+		state = &caseState{}
+		r.caseStates[addr.String()] = state
+	}
+	state.mismatches++
+	if state.mismatches >= caseMismatchLimit {
+		state.mismatches = 0
+		state.fallbackUntil = time.Now().Add(caseFallbackTTL)
+	}
+}
+
+// caseMatch records that the server at addr echoed the case of a query name.
+func (r *Resolver) caseMatch(addr net.IP) {
+	r.caseMu.Lock()
+	defer r.caseMu.Unlock()
+	delete(r.caseStates, addr.String())
+}
+
+// randomCase returns a copy of name with each letter in random case.
+func randomCase(name dns.Name) dns.Name {
+	mixed := make(dns.Name, len(name))
+	for i, label := range name {
+		bits := make([]byte, len(label))
+		if _, err := rand.Read(bits); err != nil {
+			panic("resolver: reading random bytes: " + err.Error())
+		}
+
+		mixed[i] = make([]byte, len(label))
+		for j, c := range label {
+			if isLetter(c) && bits[j]&1 == 1 {
+				c ^= 0x20
+			}
+			mixed[i][j] = c
+		}
+	}
+	return mixed
+}
+
+func isLetter(c byte) bool {
+	return ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z')
+}
+
+// restoreCase gives the question of the response, and the records owned by
+// the query name, the case the name was asked for in.
+func restoreCase(resp dns.Packet, name dns.Name) dns.Packet {
+	resp.Questions = []dns.Question{resp.Questions[0]}
+	resp.Questions[0].Name = name
+	for _, section := range []*[]dns.ResourceRecord{&resp.Answers, &resp.Authorities, &resp.Additional} {
+		records := make([]dns.ResourceRecord, len(*section))
+		for i, rec := range *section {
+			if rec.Name.Equals(name) {
+				rec.Name = name
+			}
+			records[i] = rec
+		}
+		*section = records
+	}
+	return resp
+}
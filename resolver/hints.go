@@ -0,0 +1,86 @@
+package resolver
+
+import (
+	"io"
+	"net"
+
+	"github.com/davidseybold/dns-resolver/dns"
+	"github.com/davidseybold/dns-resolver/dns/zonefile"
+)
+
+const rootHintsTTL = 3600000
+
+// builtinRootHints are the root name servers as published by IANA in
+// https://www.internic.net/domain/named.root
+var builtinRootHints = []struct {
+	name string
+	addr string
+}{
+	{"a.root-servers.net.", "198.41.0.4"},
+	{"b.root-servers.net.", "170.247.170.2"},
+	{"c.root-servers.net.", "192.33.4.12"},
+	{"d.root-servers.net.", "199.7.91.13"},
+	{"e.root-servers.net.", "192.203.230.10"},
+	{"f.root-servers.net.", "192.5.5.241"},
+	{"g.root-servers.net.", "192.112.36.4"},
+	{"h.root-servers.net.", "198.97.190.53"},
+	{"i.root-servers.net.", "192.36.148.17"},
+	{"j.root-servers.net.", "192.58.128.30"},
+	{"k.root-servers.net.", "193.0.14.129"},
+	{"l.root-servers.net.", "199.7.83.42"},
+	{"m.root-servers.net.", "202.12.27.33"},
+}
+
+// RootHints returns the built in root hints as NS records for the root and
+// A records for each of the servers.
+func RootHints() []dns.ResourceRecord {
+	root := dns.NewName(".")
+	nsRecords := []dns.ResourceRecord{}
+	aRecords := []dns.ResourceRecord{}
+	for _, h := range builtinRootHints {
+		ns := &dns.NSRecordData{}
+		ns.Name = dns.NewName(h.name)
+		nsRecords = append(nsRecords, dns.ResourceRecord{
+			Name:  root,
+			Type:  dns.TypeNS,
+			Class: dns.ClassIN,
+			TTL:   rootHintsTTL,
+			Data:  ns,
+		})
+		aRecords = append(aRecords, dns.ResourceRecord{
+			Name:  ns.Name,
+			Type:  dns.TypeA,
+			Class: dns.ClassIN,
+			TTL:   rootHintsTTL,
+			Data:  &dns.ARecordData{Address: net.ParseIP(h.addr).To4()},
+		})
+	}
+	return append(nsRecords, aRecords...)
+}
+
+// LoadRootHints reads root hints from a named.root file.
+func LoadRootHints(path string) ([]dns.ResourceRecord, error) {
+	return zonefile.ParseFile(path, dns.NewName("."))
+}
+
+// ParseRootHints parses root hints in the master file format of the
+// named.root file distributed by IANA.
+func ParseRootHints(r io.Reader) ([]dns.ResourceRecord, error) {
+	return zonefile.Parse(r, dns.NewName("."))
+}
+
+// newSBelt builds the SBELT from root hints.
+func newSBelt(hints []dns.ResourceRecord) sList {
+	root := dns.NewName(".")
+	list := newSList(root)
+	for _, ns := range filterRecords(hints, root, dns.TypeNS, dns.ClassIN) {
+		name := ns.Data.(*dns.NSRecordData).Name
+
+		var addr net.IP
+		if a := filterRecords(hints, name, dns.TypeA, dns.ClassIN); len(a) > 0 {
+			addr = a[0].Data.(*dns.ARecordData).Address
+		}
+		list.Add(name, addr)
+	}
+	return *list
+}
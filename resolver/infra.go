@@ -0,0 +1,176 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/davidseybold/dns-resolver/resolver/transport"
+)
+
+const (
+	// statsTTL is how long the statistics of a server are kept after it was
+	// last queried. Expired statistics are forgotten, so that a server is
+	// judged afresh once the network has had time to change.
+	statsTTL = 15 * time.Minute
+
+	// rttGain and avgGain weigh each new sample against the smoothed RTT
+	// and batting average, as in RFC 6298 §2.
+	rttGain = 0.125
+	avgGain = 0.1
+	// failureRTT is the RTT sample recorded when a server does not respond.
+	failureRTT = transport.DefaultUDPTimeout
+
+	// A server that fails to respond is not queried again, unless there is
+	// no other choice, for minBackoff, doubling with each further failure
+	// up to maxBackoff.
+	minBackoff = time.Second
+	maxBackoff = 2 * time.Minute
+)
+
+// serverStats is what is known about how a name server address performs.
+type serverStats struct {
+	addrScore
+	// failures is the number of consecutive queries it failed to respond
+	// to.
+	failures int
+	updated  time.Time
+}
+
+// infraCache keeps the statistics of the name server addresses queried, so
+// that the fastest and most reliable servers can be preferred.
+type infraCache struct {
+	mu     *sync.Mutex
+	stats  map[string]*serverStats
+	pruned time.Time
+}
+
+func newInfraCache() *infraCache {
+	return &infraCache{
+		mu:     &sync.Mutex{},
+		stats:  make(map[string]*serverStats),
+		pruned: time.Now(),
+	}
+}
+
+// fill sets the scores of the addresses in the SList that have statistics.
+func (c *infraCache) fill(list *sList) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	for i := range list.ZoneNS {
+		addr := list.addr(i)
+		if addr == nil {
+			continue
+		}
+		key := addr.String()
+		if s, ok := c.get(key, now); ok {
+			list.AddrScores[key] = s.addrScore
+		} else {
+			delete(list.AddrScores, key)
+		}
+	}
+}
+
+// success records that the server at addr responded after rtt.
+func (c *infraCache) success(addr net.IP, rtt time.Duration) {
+	c.update(addr, func(s *serverStats) {
+		s.sample(rtt, 1)
+		s.failures = 0
+		s.BackoffUntil = time.Time{}
+	})
+}
+
+// miss records that the server at addr responded after rtt, but not with a
+// response that could be used.
+func (c *infraCache) miss(addr net.IP, rtt time.Duration) {
+	c.update(addr, func(s *serverStats) {
+		s.sample(rtt, 0)
+		s.failures = 0
+	})
+}
+
+// failure records that the server at addr did not respond, and backs off
+// from it exponentially.
+func (c *infraCache) failure(addr net.IP) {
+	c.update(addr, func(s *serverStats) {
+		s.sample(failureRTT, 0)
+		s.failures++
+
+		backoff := maxBackoff
+		if s.failures < 8 && minBackoff<<(s.failures-1) < maxBackoff {
+			backoff = minBackoff << (s.failures - 1)
+		}
+		s.BackoffUntil = time.Now().Add(backoff)
+	})
+}
+
+// exchangeError records the error an exchange with the server at addr
+// failed with after rtt. Only timeouts count as the server not responding;
+// other errors, such as a malformed response, are misses.
+func (c *infraCache) exchangeError(addr net.IP, rtt time.Duration, err error) {
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		c.failure(addr)
+		return
+	}
+	c.miss(addr, rtt)
+}
+
+func (c *infraCache) update(addr net.IP, f func(*serverStats)) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	now := time.Now()
+	key := addr.String()
+	s, ok := c.get(key, now)
+	if !ok {
+		s = &serverStats{}
+		c.stats[key] = s
+	}
+	f(s)
+	s.updated = now
+
+	if now.Sub(c.pruned) > statsTTL {
+		c.prune(now)
+	}
+}
+
+// get returns the statistics of the address, dropping them if they have
+// expired. c.mu must be held.
+func (c *infraCache) get(key string, now time.Time) (*serverStats, bool) {
+	s, ok := c.stats[key]
+	if !ok {
+		return nil, false
+	}
+	if now.Sub(s.updated) > statsTTL {
+		delete(c.stats, key)
+		return nil, false
+	}
+	return s, true
+}
+
+// prune drops all expired statistics. c.mu must be held.
+func (c *infraCache) prune(now time.Time) {
+	for key, s := range c.stats {
+		if now.Sub(s.updated) > statsTTL {
+			delete(c.stats, key)
+		}
+	}
+	c.pruned = now
+}
+
+// sample folds an RTT and an outcome, 1 for success and 0 for failure, into
+// the smoothed RTT and batting average. The first sample replaces them.
+func (s *serverStats) sample(rtt time.Duration, outcome float32) {
+	if s.updated.IsZero() {
+		s.SmoothedRTT = rtt
+		s.BattingAvg = outcome
+		return
+	}
+	s.SmoothedRTT += time.Duration(rttGain * float64(rtt-s.SmoothedRTT))
+	s.BattingAvg += avgGain * (outcome - s.BattingAvg)
+}
@@ -0,0 +1,257 @@
+package resolver
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"net"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/davidseybold/dns-resolver/dns"
+)
+
+// The lookups in this file follow the signatures of net.Resolver, so that the
+// resolver can be used in its place.
+
+// LookupHostContext looks up the IPv4 and IPv6 addresses of the host. The
+// IPv4 addresses come first. An error is only returned if no addresses were
+// found.
+func (r *Resolver) LookupHostContext(ctx context.Context, host string) ([]net.IP, error) {
+	name := dns.NewName(host)
+	types := []dns.Type{dns.TypeA, dns.TypeAAAA}
+
+	records := make([][]dns.ResourceRecord, len(types))
+	errs := make([]error, len(types))
+	var wg sync.WaitGroup
+	for i, t := range types {
+		wg.Add(1)
+		go func(i int, t dns.Type) {
+			defer wg.Done()
+			records[i], errs[i] = r.LookupContext(ctx, name, dns.ClassIN, t)
+		}(i, t)
+	}
+	wg.Wait()
+
+	ips := []net.IP{}
+	for _, recs := range records {
+		for _, rec := range recs {
+			switch data := rec.Data.(type) {
+			case *dns.ARecordData:
+				ips = append(ips, data.Address)
+			case *dns.AAAARecordData:
+				ips = append(ips, data.Address)
+			}
+		}
+	}
+	if len(ips) == 0 {
+		for _, err := range errs {
+			if err != nil {
+				return ips, err
+			}
+		}
+	}
+	return ips, nil
+}
+
+// LookupAddressContext looks up the names of the address from the PTR records
+// of its in-addr.arpa or ip6.arpa name. CNAME records are followed, as used
+// for classless delegation of in-addr.arpa (RFC 2317).
+func (r *Resolver) LookupAddressContext(ctx context.Context, addr net.IP) ([]dns.Name, error) {
+	name, err := dns.ReverseName(addr)
+	if err != nil {
+		return nil, err
+	}
+
+	records, err := r.LookupContext(ctx, name, dns.ClassIN, dns.TypePTR)
+	if err != nil {
+		return nil, err
+	}
+	owner := canonicalName(name, records)
+	names := []dns.Name{}
+	for _, rec := range records {
+		if ptr, ok := rec.Data.(*dns.PTRRecordData); ok && rec.Name.Equals(owner) {
+			names = append(names, ptr.Name)
+		}
+	}
+	return names, nil
+}
+
+// LookupAddrContext looks up the names of the address, given as a string.
+func (r *Resolver) LookupAddrContext(ctx context.Context, addr string) ([]string, error) {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return nil, errors.New("invalid ip address " + addr)
+	}
+	names, err := r.LookupAddressContext(ctx, ip)
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]string, len(names))
+	for i, name := range names {
+		hosts[i] = name.String()
+	}
+	return hosts, nil
+}
+
+// LookupCNAME returns the canonical name of the host, found by following any
+// CNAME records from it. A host that is not an alias is its own canonical
+// name. The canonical name is returned even if it has no addresses.
+func (r *Resolver) LookupCNAME(ctx context.Context, host string) (string, error) {
+	name := dns.NewName(host)
+	records, err := r.LookupContext(ctx, name, dns.ClassIN, dns.TypeA)
+	if isDataNotFound(err) {
+		records, err = r.LookupContext(ctx, name, dns.ClassIN, dns.TypeAAAA)
+	}
+	var negErr *NegativeError
+	if isDataNotFound(err) && errors.As(err, &negErr) {
+		records, err = negErr.Answers, nil
+	}
+	if err != nil {
+		return "", err
+	}
+	return canonicalName(name, records).String(), nil
+}
+
+// LookupMX returns the MX records of the name, sorted by preference. Records
+// with the same preference are in random order, to spread the load between
+// them (RFC 5321 §5.1).
+func (r *Resolver) LookupMX(ctx context.Context, name string) ([]*net.MX, error) {
+	records, err := r.LookupContext(ctx, dns.NewName(name), dns.ClassIN, dns.TypeMX)
+	if err != nil {
+		return nil, err
+	}
+	mxs := []*net.MX{}
+	for _, rec := range records {
+		if mx, ok := rec.Data.(*dns.MXRecordData); ok {
+			mxs = append(mxs, &net.MX{Host: mx.Exchange.String(), Pref: mx.Preference})
+		}
+	}
+	sortMX(mxs)
+	return mxs, nil
+}
+
+// LookupNS returns the name servers of the name.
+func (r *Resolver) LookupNS(ctx context.Context, name string) ([]*net.NS, error) {
+	records, err := r.LookupContext(ctx, dns.NewName(name), dns.ClassIN, dns.TypeNS)
+	if err != nil {
+		return nil, err
+	}
+	nss := []*net.NS{}
+	for _, rec := range records {
+		if ns, ok := rec.Data.(*dns.NSRecordData); ok {
+			nss = append(nss, &net.NS{Host: ns.Name.String()})
+		}
+	}
+	return nss, nil
+}
+
+// LookupTXT returns the TXT records of the name. The strings of each record
+// are joined together.
+func (r *Resolver) LookupTXT(ctx context.Context, name string) ([]string, error) {
+	records, err := r.LookupContext(ctx, dns.NewName(name), dns.ClassIN, dns.TypeTXT)
+	if err != nil {
+		return nil, err
+	}
+	txts := []string{}
+	for _, rec := range records {
+		if txt, ok := rec.Data.(*dns.TXTRecordData); ok {
+			txts = append(txts, strings.Join(txt.Text, ""))
+		}
+	}
+	return txts, nil
+}
+
+// LookupSRV looks up the SRV records of _service._proto.name, or of name
+// itself if service and proto are both empty. The records are sorted by
+// priority and randomized by weight within each priority (RFC 2782). The
+// canonical name of the name looked up is returned with them.
+func (r *Resolver) LookupSRV(ctx context.Context, service, proto, name string) (string, []*net.SRV, error) {
+	target := name
+	if service != "" || proto != "" {
+		target = "_" + service + "._" + proto + "." + name
+	}
+
+	qName := dns.NewName(target)
+	records, err := r.LookupContext(ctx, qName, dns.ClassIN, dns.TypeSRV)
+	if err != nil {
+		return "", nil, err
+	}
+	srvs := []*net.SRV{}
+	for _, rec := range records {
+		if srv, ok := rec.Data.(*dns.SRVRecordData); ok {
+			srvs = append(srvs, &net.SRV{
+				Target:   srv.Target.String(),
+				Port:     srv.Port,
+				Priority: srv.Priority,
+				Weight:   srv.Weight,
+			})
+		}
+	}
+	sortSRV(srvs)
+	return canonicalName(qName, records).String(), srvs, nil
+}
+
+// canonicalName follows the CNAME records from name to the end of the chain.
+func canonicalName(name dns.Name, records []dns.ResourceRecord) dns.Name {
+	for _, rec := range records {
+		if cname, ok := rec.Data.(*dns.CNameRecordData); ok && rec.Name.Equals(name) {
+			name = cname.Name
+		}
+	}
+	return name
+}
+
+func isDataNotFound(err error) bool {
+	var dnsErr dns.Error
+	return errors.As(err, &dnsErr) && dnsErr == dns.NewDataNotFoundError()
+}
+
+// sortMX sorts the records by preference, and orders those with the same
+// preference randomly.
+func sortMX(mxs []*net.MX) {
+	rand.Shuffle(len(mxs), func(i, j int) {
+		mxs[i], mxs[j] = mxs[j], mxs[i]
+	})
+	sort.SliceStable(mxs, func(i, j int) bool {
+		return mxs[i].Pref < mxs[j].Pref
+	})
+}
+
+// sortSRV sorts the records by priority, and orders those with the same
+// priority randomly with the probability of coming first proportional to
+// their weight.
+func sortSRV(srvs []*net.SRV) {
+	sort.SliceStable(srvs, func(i, j int) bool {
+		return srvs[i].Priority < srvs[j].Priority
+	})
+	for i := 0; i < len(srvs); {
+		j := i + 1
+		for j < len(srvs) && srvs[j].Priority == srvs[i].Priority {
+			j++
+		}
+		shuffleByWeight(srvs[i:j])
+		i = j
+	}
+}
+
+func shuffleByWeight(srvs []*net.SRV) {
+	sum := 0
+	for _, srv := range srvs {
+		sum += int(srv.Weight)
+	}
+	for sum > 0 && len(srvs) > 1 {
+		n := rand.Intn(sum)
+		s := 0
+		for i := range srvs {
+			s += int(srvs[i].Weight)
+			if s > n {
+				srvs[0], srvs[i] = srvs[i], srvs[0]
+				break
+			}
+		}
+		sum -= int(srvs[0].Weight)
+		srvs = srvs[1:]
+	}
+}
@@ -0,0 +1,30 @@
+package resolver
+
+import (
+	"context"
+	"testing"
+
+	"github.com/davidseybold/dns-resolver/dns"
+	"github.com/davidseybold/dns-resolver/resolver/cache"
+)
+
+func TestLookupCNAMEWithoutAddresses(t *testing.T) {
+	c := cache.New(cache.WithSweepInterval(0))
+	c.Add(cache.CredibilityAuthAnswer, testCNAME("alias.example.", "target.example."))
+	// The target exists but has no addresses, so both lookups are answered
+	// from the cache without asking any server.
+	for _, typ := range []dns.Type{dns.TypeA, dns.TypeAAAA} {
+		c.AddNegative(dns.NewName("target.example."), typ, dns.ClassIN, cache.NegativeResponse{
+			SOA: testSOA("example."),
+		})
+	}
+	r := NewResolver(WithCache(c))
+
+	got, err := r.LookupCNAME(context.Background(), "alias.example.")
+	if err != nil {
+		t.Fatalf("LookupCNAME() error = %v", err)
+	}
+	if got != "target.example." {
+		t.Errorf("LookupCNAME() = %q, want %q", got, "target.example.")
+	}
+}
@@ -0,0 +1,63 @@
+package resolver
+
+import (
+	"github.com/davidseybold/dns-resolver/dns"
+	"github.com/davidseybold/dns-resolver/resolver/cache"
+)
+
+// NegativeError is returned when a name does not exist or has no records of
+// the type asked for. It wraps the dns.Error describing which, and carries
+// what is needed to build a negative response (RFC 2308 §2).
+type NegativeError struct {
+	Err dns.Error
+	// Answers holds the CNAME records followed before reaching the name.
+	Answers []dns.ResourceRecord
+	// SOA is the SOA record of the zone the name would be in, or nil if the
+	// response did not include one.
+	SOA *dns.ResourceRecord
+}
+
+func (e *NegativeError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *NegativeError) Unwrap() error {
+	return e.Err
+}
+
+// negativeError builds the error for a negative response to the request.
+func (r *request) negativeError(nameError bool, soa *dns.ResourceRecord) error {
+	err := dns.NewDataNotFoundError()
+	if nameError {
+		err = dns.NewNameError()
+	}
+	return &NegativeError{
+		Err:     err,
+		Answers: r.answers,
+		SOA:     soa,
+	}
+}
+
+// cacheNegative caches a negative response and returns the SOA record from
+// its authority section. Responses without an SOA record are not cached
+// (RFC 2308 §5).
+func (r *request) cacheNegative(resp dns.Packet, nameError bool) *dns.ResourceRecord {
+	for _, rec := range filterRecords(resp.Authorities, nil, dns.TypeSOA, r.SClass) {
+		data, ok := rec.Data.(*dns.SOARecordData)
+		if !ok || !r.SName.IsSubdomainOf(rec.Name) {
+			continue
+		}
+
+		// The negative response lasts for the smaller of the SOA's TTL and
+		// its MINIMUM field, and so does the SOA sent with it.
+		if data.Minimum < rec.TTL {
+			rec.TTL = data.Minimum
+		}
+		r.resolver.cache.AddNegative(r.SName, r.SType, r.SClass, cache.NegativeResponse{
+			NameError: nameError,
+			SOA:       rec,
+		})
+		return &rec
+	}
+	return nil
+}
@@ -1,25 +1,424 @@
 package resolver
 
 import (
+	"context"
+	"fmt"
 	"net"
 	"time"
 
 	"github.com/davidseybold/dns-resolver/dns"
+	"github.com/davidseybold/dns-resolver/resolver/cache"
+	"github.com/davidseybold/dns-resolver/resolver/transport"
 )
 
+const (
+	// maxSteps bounds the number of iterations of the resolution algorithm
+	// for a single request, including any sub-requests made to find the
+	// addresses of name servers.
+	maxSteps = 64
+)
+
+// Decision is the outcome of analyzing a response from a name server.
+type Decision int
+
+const (
+	// DecisionAnswer the response contains the answer to the question.
+	DecisionAnswer Decision = iota
+	// DecisionNameError the name does not exist.
+	DecisionNameError
+	// DecisionNoData the name exists but has no records of the type.
+	DecisionNoData
+	// DecisionReferral the response delegates to servers closer to the answer.
+	DecisionReferral
+	// DecisionCNAME the name is an alias and resolution restarts at the target.
+	DecisionCNAME
+	// DecisionRetry the response was unusable and another server should be asked.
+	DecisionRetry
+	// DecisionLame the server is not authoritative for the zone it was asked about.
+	DecisionLame
+)
+
+var decisionNames = map[Decision]string{
+	DecisionAnswer:    "answer",
+	DecisionNameError: "name error",
+	DecisionNoData:    "no data",
+	DecisionReferral:  "referral",
+	DecisionCNAME:     "cname",
+	DecisionRetry:     "retry",
+	DecisionLame:      "lame",
+}
+
+func (d Decision) String() string {
+	if name, ok := decisionNames[d]; ok {
+		return name
+	}
+	return fmt.Sprintf("Decision(%d)", int(d))
+}
+
 type request struct {
-	ID          int16
 	StartTime   time.Time
 	StepCounter int
 
 	SName       dns.Name
 	SType       dns.Type
 	SClass      dns.Class
-	NSList      []string
-	SBelt       []string
+	SList       *sList
 	NSAddresses map[string]net.IP
+
+	resolver *Resolver
+	// answers holds the CNAME records followed so far
+	answers []dns.ResourceRecord
+	// soa is the SOA record from the last negative response
+	soa *dns.ResourceRecord
+	// trace collects the exchanges made by the request and its sub-requests
+	// when it is not nil.
+	trace *[]TraceStep
+
+	// The result of a pending request is shared by the lookups waiting for
+	// it. waiters is guarded by the resolver's pendingMu, and records and err
+	// are set before done is closed.
+	waiters int
+	cancel  context.CancelFunc
+	done    chan struct{}
+	records []dns.ResourceRecord
+	err     error
+}
+
+func (r *Resolver) newRequest(q dns.Question) *request {
+	return &request{
+		StartTime:   time.Now(),
+		SName:       q.Name,
+		SType:       q.Type,
+		SClass:      q.Class,
+		NSAddresses: make(map[string]net.IP),
+		resolver:    r,
+		answers:     []dns.ResourceRecord{},
+	}
+}
+
+// Start runs the resolver algorithm described in RFC 1034 §5.3.3 and returns
+// the records answering the request, preceded by any CNAME records that were
+// followed to find them.
+func (r *request) Start(ctx context.Context) ([]dns.ResourceRecord, error) {
+	for {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		r.StepCounter++
+		if r.StepCounter > maxSteps {
+			return nil, dns.NewServerFailureError()
+		}
+
+		// 1. See if the answer is in local information.
+		if records, ok := r.resolver.cache.Query(r.SName, r.SType, r.SClass, cache.CredibilityAnswer); ok {
+			return append(r.answers, records...), nil
+		}
+		if r.SType != dns.TypeCNAME {
+			if cnames, ok := r.resolver.cache.Query(r.SName, dns.TypeCNAME, r.SClass, cache.CredibilityAnswer); ok {
+				r.restart(cnames[0])
+				continue
+			}
+		}
+		if neg, ok := r.resolver.cache.QueryNegative(r.SName, r.SType, r.SClass); ok {
+			return nil, r.negativeError(neg.NameError, &neg.SOA)
+		}
+
+		// 2. Find the best servers to ask.
+		if r.SList == nil {
+			r.SList = r.resolver.bestServers(ctx, r.SName, r.SClass, r.trace)
+		}
+
+		// 3. Send them queries until one returns a response.
+		resp, step, err := r.send(ctx)
+		if err != nil {
+			return nil, err
+		}
+
+		// 4. Analyze the response, once records the server is not trusted
+		// for have been removed.
+		d, records := r.analyze(scrub(resp, r.SName, r.SList.ZoneName))
+		step.Decision = d
+		r.record(step)
+		if d == DecisionRetry || d == DecisionLame {
+			r.resolver.infra.miss(step.Address, step.RTT)
+		} else {
+			r.resolver.infra.success(step.Address, step.RTT)
+		}
+		switch d {
+		case DecisionAnswer:
+			return append(r.answers, records...), nil
+		case DecisionNameError:
+			return nil, r.negativeError(true, r.soa)
+		case DecisionNoData:
+			return nil, r.negativeError(false, r.soa)
+		}
+	}
+}
+
+// send queries the servers in the SList until one of them responds. The
+// returned step describes the exchange but has no decision yet.
+func (r *request) send(ctx context.Context) (dns.Packet, TraceStep, error) {
+	for {
+		r.resolver.infra.fill(r.SList)
+		server, ok := r.SList.Next()
+		if !ok {
+			return dns.Packet{}, TraceStep{}, dns.NewServerFailureError()
+		}
+		server.Used = true
+
+		addr := server.Addr
+		if addr == nil {
+			if addr, ok = r.serverAddress(ctx, server.Name); !ok {
+				continue
+			}
+		}
+
+		query := newQuery(dns.Question{
+			Name:  r.SName,
+			Type:  r.SType,
+			Class: r.SClass,
+		})
+		query.Flags.RecursionDesired = r.resolver.forwarders != nil
+		start := time.Now()
+		resp, err := r.resolver.exchange(ctx, addr, query)
+		step := TraceStep{
+			Step:     r.StepCounter,
+			Server:   server.Name,
+			Address:  addr,
+			ZoneCut:  r.SList.ZoneName,
+			Query:    query,
+			Response: resp,
+			RTT:      time.Since(start),
+		}
+		if ctx.Err() != nil {
+			return dns.Packet{}, TraceStep{}, ctx.Err()
+		}
+		if err != nil {
+			r.resolver.infra.exchangeError(addr, step.RTT, err)
+			step.Err = err
+			step.Decision = DecisionRetry
+			r.record(step)
+			continue
+		}
+
+		return resp, step, nil
+	}
+}
+
+// record adds the step to the trace if the request is being traced.
+func (r *request) record(step TraceStep) {
+	if r.trace != nil {
+		*r.trace = append(*r.trace, step)
+	}
+}
+
+// serverAddress finds the address of a name server, resolving it if it is not
+// already known.
+func (r *request) serverAddress(ctx context.Context, name dns.Name) (net.IP, bool) {
+	key := name.LowerString()
+	if addr, ok := r.SList.NSAddr[key]; ok {
+		return addr, true
+	}
+	if addr, ok := r.NSAddresses[key]; ok {
+		return addr, true
+	}
+
+	sub := r.resolver.newRequest(dns.Question{
+		Name:  name,
+		Type:  dns.TypeA,
+		Class: dns.ClassIN,
+	})
+	sub.StepCounter = r.StepCounter
+	sub.trace = r.trace
+	records, err := sub.Start(ctx)
+	r.StepCounter = sub.StepCounter
+	if err != nil {
+		return nil, false
+	}
+
+	for _, rec := range records {
+		if a, ok := rec.Data.(*dns.ARecordData); ok {
+			r.NSAddresses[key] = a.Address
+			return a.Address, true
+		}
+	}
+	return nil, false
+}
+
+// analyze caches the useful parts of the response and decides how the request
+// should proceed.
+func (r *request) analyze(resp dns.Packet) (Decision, []dns.ResourceRecord) {
+	switch resp.ResponseCode {
+	case dns.ResponseCodeNoError:
+	case dns.ResponseCodeNXDomain:
+		r.cacheAnswers(resp)
+		// The response code is about the name at the end of any CNAME
+		// chain in the answers (RFC 2308 §2.1), which the server can only
+		// speak for if it is in its zone.
+		if r.followCNAMEs(resp) && !r.SName.IsSubdomainOf(r.SList.ZoneName) {
+			r.SList = nil
+			return DecisionCNAME, nil
+		}
+		r.soa = r.cacheNegative(resp, true)
+		return DecisionNameError, nil
+	default:
+		return DecisionRetry, nil
+	}
+
+	r.cacheAnswers(resp)
+
+	answers := filterRecords(resp.Answers, r.SName, r.SType, r.SClass)
+	if len(answers) > 0 {
+		return DecisionAnswer, answers
+	}
+
+	if r.followCNAMEs(resp) {
+		if answers := filterRecords(resp.Answers, r.SName, r.SType, r.SClass); len(answers) > 0 {
+			return DecisionAnswer, answers
+		}
+		// A response whose chain ends in its own zone without an answer
+		// says the name at the end has no data (RFC 2308 §2.2), if it has
+		// the SOA record to say how long for.
+		if r.SName.IsSubdomainOf(r.SList.ZoneName) {
+			if soa := r.cacheNegative(resp, false); soa != nil {
+				r.soa = soa
+				return DecisionNoData, nil
+			}
+		}
+		r.SList = nil
+		return DecisionCNAME, nil
+	}
+
+	// Authoritative responses are never referrals, even when they list the
+	// zone's own name servers alongside a NODATA answer.
+	if zone, ok := r.referral(resp); ok && !resp.Flags.AuthoritativeAnswer {
+		if !zone.IsSubdomainOf(r.SList.ZoneName) || zone.Equals(r.SList.ZoneName) {
+			return DecisionLame, nil
+		}
+		r.follow(zone, resp)
+		return DecisionReferral, nil
+	}
+
+	if resp.Flags.AuthoritativeAnswer || len(filterRecords(resp.Authorities, nil, dns.TypeSOA, r.SClass)) > 0 {
+		r.soa = r.cacheNegative(resp, false)
+		return DecisionNoData, nil
+	}
+
+	return DecisionRetry, nil
+}
+
+// cacheAnswers caches the answer section of a response. An authoritative
+// response is only authoritative for the records of the name asked about, not
+// for those found by following its CNAME records (RFC 2181 §5.4.1).
+func (r *request) cacheAnswers(resp dns.Packet) {
+	cred := answerCredibility(resp)
+	if cred != cache.CredibilityAuthAnswer {
+		r.resolver.cacheRecords(cred, resp.Answers)
+		return
+	}
+
+	owned, other := []dns.ResourceRecord{}, []dns.ResourceRecord{}
+	for _, rec := range resp.Answers {
+		if rec.Name.Equals(r.SName) {
+			owned = append(owned, rec)
+		} else {
+			other = append(other, rec)
+		}
+	}
+	r.resolver.cacheRecords(cred, owned)
+	r.resolver.cacheRecords(cache.CredibilityAnswer, other)
+}
+
+// referral returns the zone delegated to by the response, if any.
+func (r *request) referral(resp dns.Packet) (dns.Name, bool) {
+	for _, rec := range resp.Authorities {
+		if rec.Type == dns.TypeNS && r.SName.IsSubdomainOf(rec.Name) {
+			return rec.Name, true
+		}
+	}
+	return nil, false
+}
+
+// follow replaces the SList with the servers the response delegates to.
+func (r *request) follow(zone dns.Name, resp dns.Packet) {
+	nsRecords := filterRecords(resp.Authorities, zone, dns.TypeNS, r.SClass)
+	r.resolver.cacheRecords(authorityCredibility(resp), nsRecords)
+
+	list := newSList(zone)
+	for _, rec := range nsRecords {
+		ns, ok := rec.Data.(*dns.NSRecordData)
+		if !ok {
+			continue
+		}
+
+		glue := filterRecords(resp.Additional, ns.Name, dns.TypeA, dns.ClassIN)
+		r.resolver.cacheRecords(additionalCredibility(resp), glue)
+
+		var addr net.IP
+		if len(glue) > 0 {
+			addr = glue[0].Data.(*dns.ARecordData).Address
+			r.NSAddresses[ns.Name.LowerString()] = addr
+		}
+		list.Add(ns.Name, addr)
+	}
+	r.SList = list
+}
+
+// followCNAMEs follows the chain of CNAME records in the answers of the
+// response from SName, adding them to the request's answers and moving SName
+// to the end of the chain. It reports whether there were any to follow.
+func (r *request) followCNAMEs(resp dns.Packet) bool {
+	if r.SType == dns.TypeCNAME {
+		return false
+	}
+	followed := false
+	// Each record is followed at most once, which also ends loops.
+	for range resp.Answers {
+		cnames := filterRecords(resp.Answers, r.SName, dns.TypeCNAME, r.SClass)
+		if len(cnames) == 0 {
+			break
+		}
+		r.answers = append(r.answers, cnames[0])
+		r.SName = cnames[0].Data.(*dns.CNameRecordData).Name
+		followed = true
+	}
+	return followed
+}
+
+// restart continues the request at the target of the CNAME record.
+func (r *request) restart(cname dns.ResourceRecord) {
+	r.answers = append(r.answers, cname)
+	r.SName = cname.Data.(*dns.CNameRecordData).Name
+	r.SList = nil
+}
+
+func newQuery(q dns.Question) dns.Packet {
+	p := dns.Packet{
+		Questions: []dns.Question{q},
+		OPT: &dns.OPT{
+			UDPPayloadSize: dns.DefaultUDPPayloadSize,
+		},
+	}
+	p.ID = transport.NewID()
+	return p
 }
 
-func (r *request) Start() error {
-	return nil
+// filterRecords returns the records matching the name, type and class. A nil
+// name matches records with any name.
+func filterRecords(records []dns.ResourceRecord, name dns.Name, t dns.Type, c dns.Class) []dns.ResourceRecord {
+	filtered := []dns.ResourceRecord{}
+	for _, rec := range records {
+		if name != nil && !rec.Name.Equals(name) {
+			continue
+		}
+		if t != dns.QTypeAll && rec.Type != t {
+			continue
+		}
+		if c != dns.QClassAny && rec.Class != c {
+			continue
+		}
+		filtered = append(filtered, rec)
+	}
+	return filtered
 }
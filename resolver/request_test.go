@@ -0,0 +1,244 @@
+package resolver
+
+import (
+	"errors"
+	"net"
+	"testing"
+
+	"github.com/davidseybold/dns-resolver/dns"
+	"github.com/davidseybold/dns-resolver/resolver/cache"
+)
+
+func testRecord(name string, t dns.Type, data dns.RecordData) dns.ResourceRecord {
+	return dns.ResourceRecord{
+		Name:  dns.NewName(name),
+		Type:  t,
+		Class: dns.ClassIN,
+		TTL:   300,
+		Data:  data,
+	}
+}
+
+func testA(name, addr string) dns.ResourceRecord {
+	return testRecord(name, dns.TypeA, &dns.ARecordData{Address: net.ParseIP(addr)})
+}
+
+func testNS(zone, host string) dns.ResourceRecord {
+	data := &dns.NSRecordData{}
+	data.Name = dns.NewName(host)
+	return testRecord(zone, dns.TypeNS, data)
+}
+
+func testCNAME(name, target string) dns.ResourceRecord {
+	data := &dns.CNameRecordData{}
+	data.Name = dns.NewName(target)
+	return testRecord(name, dns.TypeCNAME, data)
+}
+
+func testSOA(zone string) dns.ResourceRecord {
+	return testRecord(zone, dns.TypeSOA, &dns.SOARecordData{
+		MName:   dns.NewName("ns." + zone),
+		RName:   dns.NewName("hostmaster." + zone),
+		Minimum: 60,
+	})
+}
+
+// testRequest returns a request for the A records of name being sent to the
+// servers of zone.
+func testRequest(name, zone string) *request {
+	r := NewResolver(WithCache(cache.New(cache.WithSweepInterval(0))))
+	req := r.newRequest(dns.Question{Name: dns.NewName(name), Type: dns.TypeA, Class: dns.ClassIN})
+	req.SList = newSList(dns.NewName(zone))
+	return req
+}
+
+func TestAnalyze(t *testing.T) {
+	tests := []struct {
+		name  string
+		resp  dns.Packet
+		rcode dns.ResponseCode
+		aa    bool
+
+		want        Decision
+		wantRecords int
+		// wantSName is where the request continues, if it moved.
+		wantSName string
+		// wantAnswers is the number of CNAME records followed.
+		wantAnswers int
+		// wantZone is the zone of the servers to ask next, if they changed.
+		wantZone string
+	}{
+		{
+			name:        "answer",
+			resp:        dns.Packet{Answers: []dns.ResourceRecord{testA("www.example.", "192.0.2.1")}},
+			aa:          true,
+			want:        DecisionAnswer,
+			wantRecords: 1,
+		},
+		{
+			name:        "cname out of zone",
+			resp:        dns.Packet{Answers: []dns.ResourceRecord{testCNAME("www.example.", "www.other.")}},
+			aa:          true,
+			want:        DecisionCNAME,
+			wantSName:   "www.other.",
+			wantAnswers: 1,
+		},
+		{
+			name: "cname chain with answer",
+			resp: dns.Packet{Answers: []dns.ResourceRecord{
+				testCNAME("www.example.", "web.example."),
+				testCNAME("web.example.", "host.example."),
+				testA("host.example.", "192.0.2.1"),
+			}},
+			aa:          true,
+			want:        DecisionAnswer,
+			wantRecords: 1,
+			wantSName:   "host.example.",
+			wantAnswers: 2,
+		},
+		{
+			name: "cname chain to no data",
+			resp: dns.Packet{
+				Answers:     []dns.ResourceRecord{testCNAME("www.example.", "web.example.")},
+				Authorities: []dns.ResourceRecord{testSOA("example.")},
+			},
+			aa:          true,
+			want:        DecisionNoData,
+			wantSName:   "web.example.",
+			wantAnswers: 1,
+		},
+		{
+			name: "cname loop",
+			resp: dns.Packet{Answers: []dns.ResourceRecord{
+				testCNAME("www.example.", "web.example."),
+				testCNAME("web.example.", "www.example."),
+			}},
+			aa:          true,
+			want:        DecisionCNAME,
+			wantSName:   "www.example.",
+			wantAnswers: 2,
+		},
+		{
+			name: "referral",
+			resp: dns.Packet{
+				Authorities: []dns.ResourceRecord{testNS("www.example.", "ns.www.example.")},
+				Additional:  []dns.ResourceRecord{testA("ns.www.example.", "192.0.2.53")},
+			},
+			want:     DecisionReferral,
+			wantZone: "www.example.",
+		},
+		{
+			name: "referral to the same zone",
+			resp: dns.Packet{Authorities: []dns.ResourceRecord{testNS("example.", "ns.example.")}},
+			want: DecisionLame,
+		},
+		{
+			name: "no data with soa",
+			resp: dns.Packet{Authorities: []dns.ResourceRecord{testSOA("example.")}},
+			aa:   true,
+			want: DecisionNoData,
+		},
+		{
+			name: "no data with the zone's name servers",
+			resp: dns.Packet{Authorities: []dns.ResourceRecord{testNS("example.", "ns.example.")}},
+			aa:   true,
+			want: DecisionNoData,
+		},
+		{
+			name:  "name error",
+			resp:  dns.Packet{Authorities: []dns.ResourceRecord{testSOA("example.")}},
+			aa:    true,
+			rcode: dns.ResponseCodeNXDomain,
+			want:  DecisionNameError,
+		},
+		{
+			name: "name error at the end of a cname chain",
+			resp: dns.Packet{
+				Answers:     []dns.ResourceRecord{testCNAME("www.example.", "missing.example.")},
+				Authorities: []dns.ResourceRecord{testSOA("example.")},
+			},
+			aa:          true,
+			rcode:       dns.ResponseCodeNXDomain,
+			want:        DecisionNameError,
+			wantSName:   "missing.example.",
+			wantAnswers: 1,
+		},
+		{
+			name:        "name error after a cname out of zone",
+			resp:        dns.Packet{Answers: []dns.ResourceRecord{testCNAME("www.example.", "www.other.")}},
+			aa:          true,
+			rcode:       dns.ResponseCodeNXDomain,
+			want:        DecisionCNAME,
+			wantSName:   "www.other.",
+			wantAnswers: 1,
+		},
+		{
+			name:  "server failure",
+			resp:  dns.Packet{},
+			rcode: dns.ResponseCodeServerFailure,
+			want:  DecisionRetry,
+		},
+		{
+			name: "empty non-authoritative response",
+			resp: dns.Packet{},
+			want: DecisionRetry,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := testRequest("www.example.", "example.")
+			resp := tt.resp
+			resp.ResponseCode = tt.rcode
+			resp.Flags.AuthoritativeAnswer = tt.aa
+
+			got, records := req.analyze(resp)
+			if got != tt.want {
+				t.Fatalf("analyze() = %v, want %v", got, tt.want)
+			}
+			if len(records) != tt.wantRecords {
+				t.Errorf("analyze() returned %d records, want %d", len(records), tt.wantRecords)
+			}
+			wantSName := tt.wantSName
+			if wantSName == "" {
+				wantSName = "www.example."
+			}
+			if !req.SName.Equals(dns.NewName(wantSName)) {
+				t.Errorf("SName = %v, want %s", req.SName, wantSName)
+			}
+			if len(req.answers) != tt.wantAnswers {
+				t.Errorf("answers = %v, want %d records", req.answers, tt.wantAnswers)
+			}
+			if tt.wantZone != "" && (req.SList == nil || !req.SList.ZoneName.Equals(dns.NewName(tt.wantZone))) {
+				t.Errorf("SList = %v, want the servers of %s", req.SList, tt.wantZone)
+			}
+		})
+	}
+}
+
+func TestAnalyzeNameErrorCNAMEChain(t *testing.T) {
+	req := testRequest("alias.example.", "example.")
+	resp := dns.Packet{
+		Answers:     []dns.ResourceRecord{testCNAME("alias.example.", "missing.example.")},
+		Authorities: []dns.ResourceRecord{testSOA("example.")},
+	}
+	resp.ResponseCode = dns.ResponseCodeNXDomain
+	resp.Flags.AuthoritativeAnswer = true
+
+	if d, _ := req.analyze(resp); d != DecisionNameError {
+		t.Fatalf("analyze() = %v, want %v", d, DecisionNameError)
+	}
+
+	c := req.resolver.cache
+	if _, ok := c.QueryNegative(dns.NewName("missing.example."), dns.TypeA, dns.ClassIN); !ok {
+		t.Errorf("name error for the end of the chain was not cached")
+	}
+	if _, ok := c.QueryNegative(dns.NewName("alias.example."), dns.TypeA, dns.ClassIN); ok {
+		t.Errorf("name error was cached for the alias")
+	}
+
+	var negErr *NegativeError
+	if err := req.negativeError(true, req.soa); !errors.As(err, &negErr) || len(negErr.Answers) != 1 {
+		t.Errorf("negativeError() = %v, want one with the CNAME record", err)
+	}
+}
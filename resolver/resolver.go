@@ -1,53 +1,369 @@
 package resolver
 
 import (
+	"context"
+	"fmt"
 	"net"
+	"sync"
+	"time"
 
 	"github.com/davidseybold/dns-resolver/dns"
 	"github.com/davidseybold/dns-resolver/resolver/cache"
+	"github.com/davidseybold/dns-resolver/resolver/transport"
 )
 
+// DefaultLookupTimeout is how long a question may take to resolve unless
+// WithLookupTimeout says otherwise.
+const DefaultLookupTimeout = 30 * time.Second
+
 type Resolver struct {
-	cache           *cache.Cache
-	sBelt           srvList
+	cache *cache.Cache
+	sBelt sList
+	// pendingRequests holds the requests being resolved, by question, so
+	// that identical lookups made at the same time share one resolution.
 	pendingRequests map[string]*request
+	pendingMu       *sync.Mutex
+	primeMu         *sync.Mutex
+	transport       *transport.Transport
+	// infra holds the statistics of the name servers queried, used to
+	// choose which to query.
+	infra *infraCache
+	// forwarders, when set, are asked to resolve every query recursively
+	// instead of iterating from the root.
+	forwarders *sList
+	// lookupTimeout bounds how long a request shared by lookups may run.
+	lookupTimeout time.Duration
+
+	randomizeCase bool
+	// caseStates holds, by address, the servers that have not echoed the
+	// case of query names.
+	caseStates map[string]*caseState
+	caseMu     *sync.Mutex
 }
 
-func NewResolver() *Resolver {
-	return &Resolver{
-		cache: cache.New(),
+// Option configures a Resolver.
+type Option func(*Resolver)
+
+// WithRootHints replaces the built in root hints used to seed the SBELT.
+func WithRootHints(hints []dns.ResourceRecord) Option {
+	return func(r *Resolver) {
+		r.sBelt = newSBelt(hints)
 	}
 }
 
-func (r *Resolver) LookupHost(name string) ([]net.IP, error) {
-	records, err := r.Lookup(dns.NewName(name), dns.ClassIN, dns.TypeA)
-	if err != nil {
-		return []net.IP{}, err
+// WithTransport sets the transport used to query name servers.
+func WithTransport(t *transport.Transport) Option {
+	return func(r *Resolver) {
+		r.transport = t
 	}
-	ips := []net.IP{}
-	for _, r := range records {
-		a, ok := r.Data.(dns.ARecordData)
-		if ok {
-			ips = append(ips, a.Address)
+}
+
+// WithCache sets the cache the resolver stores records in.
+func WithCache(c *cache.Cache) Option {
+	return func(r *Resolver) {
+		r.cache = c
+	}
+}
+
+// WithLookupTimeout sets how long the resolver may spend resolving a
+// question, however long the lookups waiting for the answer are willing to
+// wait.
+func WithLookupTimeout(d time.Duration) Option {
+	return func(r *Resolver) {
+		r.lookupTimeout = d
+	}
+}
+
+// WithForwarders makes the resolver send its queries, with recursion desired,
+// to the given servers rather than resolving them iteratively.
+func WithForwarders(addrs []net.IP) Option {
+	return func(r *Resolver) {
+		if len(addrs) == 0 {
+			r.forwarders = nil
+			return
+		}
+		list := newSList(dns.NewName("."))
+		for _, addr := range addrs {
+			list.AddAddress(addr)
 		}
+		r.forwarders = list
 	}
-	return ips, nil
 }
 
-func (r *Resolver) LookupAddress(addr net.IP) ([][]byte, error) {
+// NewResolver creates a resolver. Without WithCache it creates a cache of its
+// own with the default settings, which is never closed.
+func NewResolver(opts ...Option) *Resolver {
+	r := &Resolver{
+		sBelt:           newSBelt(RootHints()),
+		pendingRequests: make(map[string]*request),
+		pendingMu:       &sync.Mutex{},
+		primeMu:         &sync.Mutex{},
+		transport:       transport.New(),
+		lookupTimeout:   DefaultLookupTimeout,
+		infra:           newInfraCache(),
+		caseStates:      make(map[string]*caseState),
+		caseMu:          &sync.Mutex{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	// The default cache is only created when no other was given, since it
+	// starts a goroutine that would otherwise leak.
+	if r.cache == nil {
+		r.cache = cache.New()
+	}
+	return r
+}
 
-	return nil, nil
+// LookupHost looks up the IPv4 and IPv6 addresses of the host.
+func (r *Resolver) LookupHost(name string) ([]net.IP, error) {
+	return r.LookupHostContext(context.Background(), name)
+}
+
+// LookupAddress looks up the names of the address.
+func (r *Resolver) LookupAddress(addr net.IP) ([]dns.Name, error) {
+	return r.LookupAddressContext(context.Background(), addr)
 }
 
 func (r *Resolver) Lookup(qName dns.Name, qClass dns.Class, qType dns.Type) ([]dns.ResourceRecord, error) {
-	return r.lookup(dns.Question{
+	return r.LookupContext(context.Background(), qName, qClass, qType)
+}
+
+// LookupContext resolves the question and returns the records answering it,
+// preceded by any CNAME records that were followed to find them. Cancelling
+// ctx cancels the queries being sent upstream.
+func (r *Resolver) LookupContext(ctx context.Context, qName dns.Name, qClass dns.Class, qType dns.Type) ([]dns.ResourceRecord, error) {
+	return r.lookup(ctx, dns.Question{
 		Name:  qName,
 		Class: qClass,
 		Type:  qType,
 	})
 }
 
-func (r *Resolver) lookup(question dns.Question) ([]dns.ResourceRecord, error) {
+// lookup resolves the question, joining the pending request for it if there
+// is one. The request runs until it finishes, every lookup waiting for it has
+// given up, or the lookup timeout passes, so one lookup being cancelled does
+// not affect the others but no request runs forever.
+func (r *Resolver) lookup(ctx context.Context, question dns.Question) ([]dns.ResourceRecord, error) {
+	key := questionKey(question)
+
+	r.pendingMu.Lock()
+	req, ok := r.pendingRequests[key]
+	if !ok {
+		req = r.newRequest(question)
+		var reqCtx context.Context
+		reqCtx, req.cancel = context.WithTimeout(context.Background(), r.lookupTimeout)
+		req.done = make(chan struct{})
+		r.pendingRequests[key] = req
+		go r.run(reqCtx, key, req)
+	}
+	req.waiters++
+	r.pendingMu.Unlock()
+
+	select {
+	case <-req.done:
+		return append([]dns.ResourceRecord{}, req.records...), req.err
+	case <-ctx.Done():
+		r.pendingMu.Lock()
+		req.waiters--
+		if req.waiters == 0 {
+			req.cancel()
+			r.removePending(key, req)
+		}
+		r.pendingMu.Unlock()
+		return nil, ctx.Err()
+	}
+}
+
+// run resolves a pending request and hands the result to its waiters.
+func (r *Resolver) run(ctx context.Context, key string, req *request) {
+	records, err := req.Start(ctx)
+
+	r.pendingMu.Lock()
+	r.removePending(key, req)
+	r.pendingMu.Unlock()
+
+	req.records, req.err = records, err
+	close(req.done)
+	req.cancel()
+}
+
+// removePending removes the request from the pending requests unless it has
+// already been replaced. pendingMu must be held.
+func (r *Resolver) removePending(key string, req *request) {
+	if r.pendingRequests[key] == req {
+		delete(r.pendingRequests, key)
+	}
+}
+
+func questionKey(q dns.Question) string {
+	return fmt.Sprintf("%s/%d/%d", q.Name.LowerString(), q.Type, q.Class)
+}
+
+// Prime sends a priming query (RFC 8109) to the SBELT servers and caches the
+// root name servers and their addresses from the response. It is meant to be
+// called at startup; the resolver primes itself again whenever the root name
+// servers expire from the cache. It does nothing if they are already cached.
+func (r *Resolver) Prime() error {
+	return r.prime(context.Background(), nil)
+}
+
+// prime sends the priming query, adding its exchanges to trace if it is not
+// nil.
+func (r *Resolver) prime(ctx context.Context, trace *[]TraceStep) error {
+	r.primeMu.Lock()
+	defer r.primeMu.Unlock()
+
+	root := dns.NewName(".")
+	if _, ok := r.cache.Query(root, dns.TypeNS, dns.ClassIN, cache.CredibilityAdditional); ok {
+		return nil
+	}
+
+	list := r.sBelt.copy()
+	for {
+		r.infra.fill(list)
+		server, ok := list.Next()
+		if !ok {
+			return dns.NewServerFailureError()
+		}
+		server.Used = true
 
-	return nil, nil
+		addr, ok := list.NSAddr[server.Name.LowerString()]
+		if !ok {
+			continue
+		}
+
+		query := newQuery(dns.Question{
+			Name:  root,
+			Type:  dns.TypeNS,
+			Class: dns.ClassIN,
+		})
+		start := time.Now()
+		resp, err := r.transport.Exchange(ctx, transport.Address(addr), query)
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		scrubbed := scrub(resp, root, root)
+
+		nsRecords := filterRecords(scrubbed.Answers, root, dns.TypeNS, dns.ClassIN)
+		step := TraceStep{
+			Server:   server.Name,
+			Address:  addr,
+			ZoneCut:  root,
+			Query:    query,
+			Response: resp,
+			RTT:      time.Since(start),
+			Err:      err,
+			Decision: DecisionAnswer,
+		}
+		if err != nil || resp.ResponseCode != dns.ResponseCodeNoError || len(nsRecords) == 0 {
+			step.Decision = DecisionRetry
+		}
+		if trace != nil {
+			*trace = append(*trace, step)
+		}
+		switch {
+		case err != nil:
+			r.infra.exchangeError(addr, step.RTT, err)
+		case step.Decision == DecisionRetry:
+			r.infra.miss(addr, step.RTT)
+		default:
+			r.infra.success(addr, step.RTT)
+		}
+		if step.Decision == DecisionRetry {
+			continue
+		}
+
+		r.cacheRecords(answerCredibility(resp), nsRecords)
+		for _, rec := range nsRecords {
+			ns := rec.Data.(*dns.NSRecordData)
+			r.cacheRecords(additionalCredibility(resp), filterRecords(scrubbed.Additional, ns.Name, dns.TypeA, dns.ClassIN))
+		}
+		return nil
+	}
+}
+
+// bestServers finds the forwarders, or otherwise the servers for the closest
+// enclosing zone of name that we have cached. When even the root name servers
+// have expired from the cache they are primed again, and the SBELT is used if
+// that fails. The priming exchanges are added to trace if it is not nil.
+func (r *Resolver) bestServers(ctx context.Context, name dns.Name, class dns.Class, trace *[]TraceStep) *sList {
+	if r.forwarders != nil {
+		return r.forwarders.copy()
+	}
+
+	for zone := name; ; zone = zone.Parent() {
+		if list, ok := r.cachedServers(zone, class); ok {
+			return list
+		}
+		if zone.IsRoot() {
+			break
+		}
+	}
+
+	root := dns.NewName(".")
+	if class == dns.ClassIN && r.prime(ctx, trace) == nil {
+		if list, ok := r.cachedServers(root, class); ok {
+			return list
+		}
+	}
+	return r.sBelt.copy()
+}
+
+// cachedServers builds an SList from the cached name servers for zone. It is
+// only usable if the address of at least one of the servers is known.
+func (r *Resolver) cachedServers(zone dns.Name, class dns.Class) (*sList, bool) {
+	nsRecords, ok := r.cache.Query(zone, dns.TypeNS, class, cache.CredibilityAdditional)
+	if !ok {
+		return nil, false
+	}
+
+	list := newSList(zone)
+	for _, rec := range nsRecords {
+		ns, ok := rec.Data.(*dns.NSRecordData)
+		if !ok {
+			continue
+		}
+
+		var addr net.IP
+		if aRecords, ok := r.cache.Query(ns.Name, dns.TypeA, dns.ClassIN, cache.CredibilityAdditional); ok {
+			addr = aRecords[0].Data.(*dns.ARecordData).Address
+		}
+		list.Add(ns.Name, addr)
+	}
+
+	return list, list.HasAddresses()
+}
+
+// cacheRecords adds the records to the cache with the given credibility. Each
+// RRset among them replaces the one already cached unless that is more
+// credible.
+func (r *Resolver) cacheRecords(cred cache.Credibility, records []dns.ResourceRecord) {
+	if len(records) > 0 {
+		r.cache.Add(cred, records...)
+	}
+}
+
+// answerCredibility, authorityCredibility and additionalCredibility return
+// the credibility of the data in each section of a response (RFC 2181
+// §5.4.1).
+func answerCredibility(resp dns.Packet) cache.Credibility {
+	if resp.Flags.AuthoritativeAnswer {
+		return cache.CredibilityAuthAnswer
+	}
+	return cache.CredibilityAnswer
+}
+
+func authorityCredibility(resp dns.Packet) cache.Credibility {
+	if resp.Flags.AuthoritativeAnswer {
+		return cache.CredibilityAuthAuthority
+	}
+	return cache.CredibilityGlue
+}
+
+func additionalCredibility(resp dns.Packet) cache.Credibility {
+	if resp.Flags.AuthoritativeAnswer {
+		return cache.CredibilityGlue
+	}
+	return cache.CredibilityAdditional
 }
@@ -1,20 +1,49 @@
 package resolver
 
 import (
+	"math/rand"
 	"net"
 	"time"
 
 	"github.com/davidseybold/dns-resolver/dns"
 )
 
+// exploreRate is how often a server other than the best scoring one is
+// chosen, so that the scores of all the servers keep being measured.
+const exploreRate = 0.05
+
+// minBattingAvg stops a server that has never responded from scoring
+// infinitely badly.
+const minBattingAvg = 0.01
+
+// srv is a name server, or a forwarder known only by its address.
 type srv struct {
-	Priority int
-	Used     bool
+	// Name is nil for forwarders.
+	Name dns.Name
+	// Addr is the address of a forwarder. The addresses of name servers are
+	// kept in the NSAddr of the SList.
+	Addr net.IP
+	Used bool
 }
 
+// addrScore is how well a name server address has performed recently.
 type addrScore struct {
-	BattingAvg         float32
-	MedianResponseTime time.Duration
+	// BattingAvg is the smoothed fraction of queries it gave a usable
+	// response to.
+	BattingAvg  float32
+	SmoothedRTT time.Duration
+	// BackoffUntil is when it may be queried again after failing to
+	// respond.
+	BackoffUntil time.Time
+}
+
+// cost estimates the time taken to get a usable response from the address.
+func (a addrScore) cost() time.Duration {
+	avg := a.BattingAvg
+	if avg < minBattingAvg {
+		avg = minBattingAvg
+	}
+	return time.Duration(float64(a.SmoothedRTT) / float64(avg))
 }
 
 type sList struct {
@@ -24,8 +53,116 @@ type sList struct {
 	AddrScores map[string]addrScore
 }
 
-// func (n srvList) SortByPriority() {
-// 	sort.Slice(n, func(i, j int) bool {
-// 		return n[i].Priority < n[j].Priority
-// 	})
-// }
+func newSList(zone dns.Name) *sList {
+	return &sList{
+		ZoneName:   zone,
+		ZoneNS:     []srv{},
+		NSAddr:     make(map[string]net.IP),
+		AddrScores: make(map[string]addrScore),
+	}
+}
+
+// Add adds a name server for the zone, along with its address if known.
+func (s *sList) Add(name dns.Name, addr net.IP) {
+	key := name.LowerString()
+	if addr != nil {
+		s.NSAddr[key] = addr
+	}
+	for i := range s.ZoneNS {
+		if s.ZoneNS[i].Name.Equals(name) {
+			return
+		}
+	}
+	s.ZoneNS = append(s.ZoneNS, srv{Name: name})
+}
+
+// AddAddress adds a server known only by its address, such as a forwarder.
+func (s *sList) AddAddress(addr net.IP) {
+	for i := range s.ZoneNS {
+		if s.ZoneNS[i].Addr.Equal(addr) {
+			return
+		}
+	}
+	s.ZoneNS = append(s.ZoneNS, srv{Addr: addr})
+}
+
+// addr returns the address of the i'th server, or nil if it is not known.
+func (s *sList) addr(i int) net.IP {
+	if s.ZoneNS[i].Addr != nil {
+		return s.ZoneNS[i].Addr
+	}
+	return s.NSAddr[s.ZoneNS[i].Name.LowerString()]
+}
+
+// Next returns the next unused server. Servers with a known address are
+// preferred so that we avoid a sub-query whenever possible, and among them
+// the one expected to respond soonest according to its AddrScores, with
+// servers never queried before tried first. Now and then another is chosen
+// at random instead. Servers backing off after failing to respond are only
+// chosen once no others are left.
+func (s *sList) Next() (*srv, bool) {
+	now := time.Now()
+	ready, backingOff := []int{}, []int{}
+	for i := range s.ZoneNS {
+		addr := s.addr(i)
+		if s.ZoneNS[i].Used || addr == nil {
+			continue
+		}
+		if s.AddrScores[addr.String()].BackoffUntil.After(now) {
+			backingOff = append(backingOff, i)
+		} else {
+			ready = append(ready, i)
+		}
+	}
+	if len(ready) == 0 {
+		ready = backingOff
+	}
+	if len(ready) > 0 {
+		if len(ready) > 1 && rand.Float64() < exploreRate {
+			return &s.ZoneNS[ready[rand.Intn(len(ready))]], true
+		}
+		best := ready[0]
+		for _, i := range ready[1:] {
+			if s.cost(i) < s.cost(best) {
+				best = i
+			}
+		}
+		return &s.ZoneNS[best], true
+	}
+
+	for i := range s.ZoneNS {
+		if !s.ZoneNS[i].Used {
+			return &s.ZoneNS[i], true
+		}
+	}
+	return nil, false
+}
+
+// cost returns the cost of the address of the i'th server. Addresses without
+// a score cost nothing, so that every server gets measured.
+func (s *sList) cost(i int) time.Duration {
+	return s.AddrScores[s.addr(i).String()].cost()
+}
+
+// HasAddresses reports whether an address is known for any server.
+func (s *sList) HasAddresses() bool {
+	for i := range s.ZoneNS {
+		if s.addr(i) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// copy returns an sList with the same servers and none of them used.
+func (s sList) copy() *sList {
+	c := newSList(s.ZoneName)
+	for _, ns := range s.ZoneNS {
+		if ns.Addr != nil {
+			c.AddAddress(ns.Addr)
+			continue
+		}
+		c.Add(ns.Name, s.NSAddr[ns.Name.LowerString()])
+	}
+	return c
+}
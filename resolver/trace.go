@@ -0,0 +1,44 @@
+package resolver
+
+import (
+	"context"
+	"net"
+	"time"
+
+	"github.com/davidseybold/dns-resolver/dns"
+)
+
+// A TraceStep records one exchange with a name server made while resolving a
+// question, and what the resolver decided to do with the response.
+type TraceStep struct {
+	// Step is the number of the iteration of the resolution algorithm the
+	// exchange was made in. Exchanges made to find the address of a name
+	// server count towards the request that needed it, and priming queries
+	// (RFC 8109) are step 0.
+	Step int
+	// Server is the name of the server queried, or nil for a forwarder, and
+	// Address the address the query was sent to.
+	Server  dns.Name
+	Address net.IP
+	// ZoneCut is the zone the server was believed to be authoritative for.
+	ZoneCut  dns.Name
+	Query    dns.Packet
+	Response dns.Packet
+	RTT      time.Duration
+	// Err is set when no usable response was received, in which case the
+	// decision is always to retry with another server.
+	Err      error
+	Decision Decision
+}
+
+// LookupTrace resolves the question like Lookup and also returns every
+// exchange with a name server that was made, in order. Answers found in the
+// cache need no exchanges, so the trace of a cached name may be empty. The
+// trace is returned even when the lookup fails.
+func (r *Resolver) LookupTrace(ctx context.Context, question dns.Question) ([]dns.ResourceRecord, []TraceStep, error) {
+	trace := []TraceStep{}
+	req := r.newRequest(question)
+	req.trace = &trace
+	records, err := req.Start(ctx)
+	return records, trace, err
+}
@@ -0,0 +1,331 @@
+// Package transport sends DNS queries to name servers. Queries are sent over
+// UDP first and retried over TCP when the response is truncated.
+package transport
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/davidseybold/dns-resolver/dns"
+)
+
+const (
+	// Port is the port name servers listen on.
+	Port = 53
+
+	DefaultUDPTimeout = 2 * time.Second
+	DefaultTCPTimeout = 5 * time.Second
+
+	maxMessageSize = 65535
+
+	// Queries over UDP are sent from a random port in this range, and
+	// portAttempts ports are tried before leaving the choice to the system.
+	minPort      = 1024
+	maxPort      = 65535
+	portAttempts = 8
+)
+
+var (
+	ErrIDMismatch       = errors.New("response id does not match query")
+	ErrQuestionMismatch = errors.New("response question does not match query")
+	ErrCaseMismatch     = errors.New("response question does not match the case of query")
+	ErrTruncated        = errors.New("response truncated")
+)
+
+// Transport sends queries to name servers.
+type Transport struct {
+	// UDPTimeout is the time allowed for a query over UDP to be answered.
+	UDPTimeout time.Duration
+	// TCPTimeout is the time allowed for a query over TCP to be answered,
+	// including establishing the connection.
+	TCPTimeout time.Duration
+}
+
+func New() *Transport {
+	return &Transport{
+		UDPTimeout: DefaultUDPTimeout,
+		TCPTimeout: DefaultTCPTimeout,
+	}
+}
+
+// Address returns the address of the name server at ip on the standard port.
+func Address(ip net.IP) string {
+	return net.JoinHostPort(ip.String(), strconv.Itoa(Port))
+}
+
+// NewID returns a cryptographically random query ID, so that responses to
+// the query cannot be forged by guessing it (RFC 5452 §4.3).
+func NewID() uint16 {
+	return randomUint16()
+}
+
+func randomUint16() uint16 {
+	var b [2]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic("transport: reading random bytes: " + err.Error())
+	}
+	return binary.BigEndian.Uint16(b[:])
+}
+
+// Exchange sends the query to the name server at addr over UDP. If the
+// response is truncated the query is sent again over TCP to the same server.
+// Servers that do not understand EDNS are queried again without it.
+func (t *Transport) Exchange(ctx context.Context, addr string, query dns.Packet) (dns.Packet, error) {
+	return t.exchange(ctx, addr, query, false)
+}
+
+// ExchangeExactCase is like Exchange, except that the response must echo the
+// query name in exactly the case it was sent in, as DNS 0x20 requires.
+// Responses differing only in case are ignored while waiting, like other
+// mismatched responses. If no matching response arrives but a NOERROR
+// response differing only in case did, ErrCaseMismatch is returned.
+func (t *Transport) ExchangeExactCase(ctx context.Context, addr string, query dns.Packet) (dns.Packet, error) {
+	return t.exchange(ctx, addr, query, true)
+}
+
+func (t *Transport) exchange(ctx context.Context, addr string, query dns.Packet, exactCase bool) (dns.Packet, error) {
+	resp, err := t.exchangeUDP(ctx, addr, query, exactCase)
+	if err != nil {
+		return dns.Packet{}, err
+	}
+	if query.OPT != nil && resp.OPT == nil && rejectsEDNS(resp.ResponseCode) {
+		query.OPT = nil
+		if resp, err = t.exchangeUDP(ctx, addr, query, exactCase); err != nil {
+			return dns.Packet{}, err
+		}
+	}
+	if !resp.Flags.Truncated {
+		return resp, nil
+	}
+	return t.exchangeTCP(ctx, addr, query, exactCase)
+}
+
+// ExchangeUDP sends the query to the name server at addr over UDP, from a
+// random port. The response is returned even if it is truncated. Packets
+// that do not come from addr, cannot be decoded, or whose ID or question do
+// not match the query, are ignored while waiting for the response (RFC 5452
+// §9.1).
+func (t *Transport) ExchangeUDP(ctx context.Context, addr string, query dns.Packet) (dns.Packet, error) {
+	return t.exchangeUDP(ctx, addr, query, false)
+}
+
+func (t *Transport) exchangeUDP(ctx context.Context, addr string, query dns.Packet, exactCase bool) (dns.Packet, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.UDPTimeout)
+	defer cancel()
+
+	server, err := net.ResolveUDPAddr("udp", addr)
+	if err != nil {
+		return dns.Packet{}, err
+	}
+	conn, err := listenUDP(server)
+	if err != nil {
+		return dns.Packet{}, err
+	}
+	defer conn.Close()
+	defer watch(ctx, conn)()
+
+	res, err := dns.EncodeUDPPacket(query)
+	if err != nil {
+		return dns.Packet{}, err
+	}
+
+	if _, err := conn.WriteToUDP(res.Bytes, server); err != nil {
+		return dns.Packet{}, contextError(ctx, err)
+	}
+
+	buffer := make([]byte, maxMessageSize)
+	var caseMismatch bool
+	for {
+		n, from, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			err = contextError(ctx, err)
+			if caseMismatch && !errors.Is(err, context.Canceled) {
+				return dns.Packet{}, ErrCaseMismatch
+			}
+			return dns.Packet{}, err
+		}
+		if !from.IP.Equal(server.IP) || from.Port != server.Port {
+			continue
+		}
+
+		resp, err := decodeResponse(buffer[:n], query, exactCase)
+		if errors.Is(err, ErrCaseMismatch) {
+			caseMismatch = true
+			continue
+		}
+		if err != nil {
+			// Malformed packets are discarded like mismatched ones, so that
+			// a single forged datagram cannot end the exchange.
+			continue
+		}
+		return resp, nil
+	}
+}
+
+// listenUDP opens a socket to send a query to server from. A random port is
+// chosen rather than left to the system, so that it cannot be predicted
+// (RFC 5452 §9.2).
+func listenUDP(server *net.UDPAddr) (*net.UDPConn, error) {
+	network := "udp4"
+	if server.IP.To4() == nil {
+		network = "udp6"
+	}
+	for i := 0; i < portAttempts; i++ {
+		port := minPort + int(randomUint16())%(maxPort-minPort+1)
+		conn, err := net.ListenUDP(network, &net.UDPAddr{Port: port})
+		if err == nil {
+			return conn, nil
+		}
+	}
+	return net.ListenUDP(network, &net.UDPAddr{})
+}
+
+// ExchangeTCP sends the query to the name server at addr over TCP.
+func (t *Transport) ExchangeTCP(ctx context.Context, addr string, query dns.Packet) (dns.Packet, error) {
+	return t.exchangeTCP(ctx, addr, query, false)
+}
+
+func (t *Transport) exchangeTCP(ctx context.Context, addr string, query dns.Packet, exactCase bool) (dns.Packet, error) {
+	ctx, cancel := context.WithTimeout(ctx, t.TCPTimeout)
+	defer cancel()
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", addr)
+	if err != nil {
+		return dns.Packet{}, err
+	}
+	defer conn.Close()
+	defer watch(ctx, conn)()
+
+	res, err := dns.EncodeTCPPacket(query)
+	if err != nil {
+		return dns.Packet{}, err
+	}
+	if res.Truncated {
+		return dns.Packet{}, ErrTruncated
+	}
+
+	msg := make([]byte, 2+len(res.Bytes))
+	binary.BigEndian.PutUint16(msg, uint16(len(res.Bytes)))
+	copy(msg[2:], res.Bytes)
+	if _, err := conn.Write(msg); err != nil {
+		return dns.Packet{}, contextError(ctx, err)
+	}
+
+	var l uint16
+	if err := binary.Read(conn, binary.BigEndian, &l); err != nil {
+		return dns.Packet{}, contextError(ctx, err)
+	}
+	buffer := make([]byte, l)
+	if _, err := io.ReadFull(conn, buffer); err != nil {
+		return dns.Packet{}, contextError(ctx, err)
+	}
+
+	return decodeResponse(buffer, query, exactCase)
+}
+
+// rejectsEDNS reports whether the response code is one that servers which do
+// not implement EDNS respond to an OPT record with (RFC 6891 §7).
+func rejectsEDNS(rcode dns.ResponseCode) bool {
+	return rcode == dns.ReponseCodeFormError || rcode == dns.ResponseCodeNotImplemented || rcode == dns.ResponseCodeServerFailure
+}
+
+// decodeResponse decodes a response and checks that it answers the query. If
+// exactCase is set the question must also match the case of the query's.
+func decodeResponse(b []byte, query dns.Packet, exactCase bool) (dns.Packet, error) {
+	resp, err := dns.DecodePacket(b)
+	if err != nil {
+		return dns.Packet{}, err
+	}
+
+	if resp.ID != query.ID {
+		return dns.Packet{}, ErrIDMismatch
+	}
+	if !matchesQuestion(resp, query) {
+		return dns.Packet{}, ErrQuestionMismatch
+	}
+	if exactCase && !matchesCase(resp, query) {
+		// Only a response that would otherwise have been used says anything
+		// about whether the server preserves case.
+		if len(resp.Questions) > 0 && resp.ResponseCode == dns.ResponseCodeNoError {
+			return dns.Packet{}, ErrCaseMismatch
+		}
+		return dns.Packet{}, ErrQuestionMismatch
+	}
+
+	return resp, nil
+}
+
+// matchesQuestion reports whether the response echoes the question of the
+// query. Some servers leave the question out of error responses, so those
+// are accepted without one.
+func matchesQuestion(resp, query dns.Packet) bool {
+	if len(resp.Questions) == 0 {
+		return resp.ResponseCode != dns.ResponseCodeNoError
+	}
+	if len(resp.Questions) != len(query.Questions) {
+		return false
+	}
+	for i, q := range query.Questions {
+		r := resp.Questions[i]
+		if r.Type != q.Type || r.Class != q.Class || !r.Name.Equals(q.Name) {
+			return false
+		}
+	}
+	return true
+}
+
+// matchesCase reports whether the names in the question of the response are
+// in exactly the case of those of the query.
+func matchesCase(resp, query dns.Packet) bool {
+	if len(resp.Questions) != len(query.Questions) {
+		return false
+	}
+	for i, q := range query.Questions {
+		r := resp.Questions[i].Name
+		if len(r) != len(q.Name) {
+			return false
+		}
+		for j := range r {
+			if !bytes.Equal(r[j], q.Name[j]) {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// watch applies the deadline of the context to the connection and unblocks
+// any reads or writes if the context is cancelled. The returned function
+// must be called once the connection is no longer in use.
+func watch(ctx context.Context, conn net.Conn) func() {
+	if deadline, ok := ctx.Deadline(); ok {
+		conn.SetDeadline(deadline)
+	}
+
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			conn.SetDeadline(time.Now())
+		case <-done:
+		}
+	}()
+	return func() { close(done) }
+}
+
+// contextError prefers the error of the context if it has ended, as that is
+// the reason the connection failed.
+func contextError(ctx context.Context, err error) error {
+	if ctxErr := ctx.Err(); ctxErr != nil {
+		return ctxErr
+	}
+	return err
+}
@@ -0,0 +1,231 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/davidseybold/dns-resolver/dns"
+)
+
+func testQuery() dns.Packet {
+	var q dns.Packet
+	q.ID = 0x1234
+	q.Questions = []dns.Question{{
+		Name:  dns.NewName("wWw.ExAmple.com."),
+		Type:  dns.TypeA,
+		Class: dns.ClassIN,
+	}}
+	return q
+}
+
+// testResponse returns a response to testQuery changed by modify.
+func testResponse(modify func(*dns.Packet)) dns.Packet {
+	resp := testQuery()
+	resp.Type = true
+	resp.Questions = append([]dns.Question{}, resp.Questions...)
+	if modify != nil {
+		modify(&resp)
+	}
+	return resp
+}
+
+// encode encodes a packet built by the tests, which is always valid.
+func encode(p dns.Packet) []byte {
+	res, err := dns.EncodeUDPPacket(p)
+	if err != nil {
+		panic(err)
+	}
+	return res.Bytes
+}
+
+func TestDecodeResponse(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*dns.Packet)
+		wantErr error
+	}{
+		{
+			name: "matching",
+		},
+		{
+			name:    "id mismatch",
+			modify:  func(p *dns.Packet) { p.ID++ },
+			wantErr: ErrIDMismatch,
+		},
+		{
+			name:    "name mismatch",
+			modify:  func(p *dns.Packet) { p.Questions[0].Name = dns.NewName("example.com.") },
+			wantErr: ErrQuestionMismatch,
+		},
+		{
+			name:    "type mismatch",
+			modify:  func(p *dns.Packet) { p.Questions[0].Type = dns.TypeAAAA },
+			wantErr: ErrQuestionMismatch,
+		},
+		{
+			name:    "class mismatch",
+			modify:  func(p *dns.Packet) { p.Questions[0].Class = dns.ClassChaos },
+			wantErr: ErrQuestionMismatch,
+		},
+		{
+			name:    "extra question",
+			modify:  func(p *dns.Packet) { p.Questions = append(p.Questions, p.Questions[0]) },
+			wantErr: ErrQuestionMismatch,
+		},
+		{
+			name:    "no question with no error",
+			modify:  func(p *dns.Packet) { p.Questions = nil },
+			wantErr: ErrQuestionMismatch,
+		},
+		{
+			name: "no question with an error",
+			modify: func(p *dns.Packet) {
+				p.Questions = nil
+				p.ResponseCode = dns.ResponseCodeServerFailure
+			},
+		},
+		{
+			name:   "case differs",
+			modify: func(p *dns.Packet) { p.Questions[0].Name = dns.NewName("www.example.com.") },
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := encode(testResponse(tt.modify))
+			_, err := decodeResponse(b, testQuery(), false)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("decodeResponse() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExchangeUDPIgnoresMismatches(t *testing.T) {
+	conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	if err != nil {
+		t.Skip("cannot listen on the loopback address:", err)
+	}
+	defer conn.Close()
+
+	go func() {
+		buffer := make([]byte, maxMessageSize)
+		_, from, err := conn.ReadFromUDP(buffer)
+		if err != nil {
+			return
+		}
+		// Forged responses arrive before the real one.
+		conn.WriteToUDP([]byte{0x12, 0x34, 0x80}, from)
+		for _, modify := range []func(*dns.Packet){
+			func(p *dns.Packet) { p.ID++ },
+			func(p *dns.Packet) { p.Questions[0].Type = dns.TypeMX },
+			func(p *dns.Packet) { p.ResponseCode = dns.ResponseCodeNXDomain },
+		} {
+			conn.WriteToUDP(encode(testResponse(modify)), from)
+		}
+	}()
+
+	tr := New()
+	tr.UDPTimeout = time.Second
+	resp, err := tr.ExchangeUDP(context.Background(), conn.LocalAddr().String(), testQuery())
+	if err != nil {
+		t.Fatalf("ExchangeUDP() error = %v", err)
+	}
+	if resp.ResponseCode != dns.ResponseCodeNXDomain {
+		t.Errorf("ExchangeUDP() response code = %v, want the matching response's %v", resp.ResponseCode, dns.ResponseCodeNXDomain)
+	}
+}
+
+func TestDecodeResponseExactCase(t *testing.T) {
+	tests := []struct {
+		name    string
+		modify  func(*dns.Packet)
+		wantErr error
+	}{
+		{
+			name: "same case",
+		},
+		{
+			name:    "case differs",
+			modify:  func(p *dns.Packet) { p.Questions[0].Name = dns.NewName("www.example.com.") },
+			wantErr: ErrCaseMismatch,
+		},
+		{
+			name: "case differs in an error",
+			modify: func(p *dns.Packet) {
+				p.Questions[0].Name = dns.NewName("www.example.com.")
+				p.ResponseCode = dns.ResponseCodeServerFailure
+			},
+			wantErr: ErrQuestionMismatch,
+		},
+		{
+			name: "no question in an error",
+			modify: func(p *dns.Packet) {
+				p.Questions = nil
+				p.ResponseCode = dns.ResponseCodeServerFailure
+			},
+			wantErr: ErrQuestionMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := encode(testResponse(tt.modify))
+			_, err := decodeResponse(b, testQuery(), true)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("decodeResponse() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExchangeExactCase(t *testing.T) {
+	lower := func(p *dns.Packet) { p.Questions[0].Name = dns.NewName("www.example.com.") }
+	tests := []struct {
+		name string
+		// responses are sent in order in reply to the query.
+		responses []func(*dns.Packet)
+		wantErr   error
+	}{
+		{
+			name:      "exact case after a case mismatch",
+			responses: []func(*dns.Packet){lower, nil},
+		},
+		{
+			name:      "only case mismatches",
+			responses: []func(*dns.Packet){lower},
+			wantErr:   ErrCaseMismatch,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conn, err := net.ListenUDP("udp4", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+			if err != nil {
+				t.Skip("cannot listen on the loopback address:", err)
+			}
+			defer conn.Close()
+
+			go func() {
+				buffer := make([]byte, maxMessageSize)
+				_, from, err := conn.ReadFromUDP(buffer)
+				if err != nil {
+					return
+				}
+				for _, modify := range tt.responses {
+					conn.WriteToUDP(encode(testResponse(modify)), from)
+				}
+			}()
+
+			tr := New()
+			tr.UDPTimeout = 200 * time.Millisecond
+			_, err = tr.ExchangeExactCase(context.Background(), conn.LocalAddr().String(), testQuery())
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("ExchangeExactCase() error = %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}